@@ -0,0 +1,287 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// generatedSuffixes mark the files written by stgo, which are not picked up again when scanning folders.
+var generatedSuffixes = []string{".translated", ".pivot", ".removed", ".fixed", ".timing", ".synced"}
+
+// inputFile is a subtitle file to translate. rel is its path relative to the folder or pattern it was found
+// from, mirrored in the output folder.
+type inputFile struct {
+	path string
+	rel  string
+}
+
+// fileStatus is the outcome of the translation of one input file.
+type fileStatus struct {
+	file     inputFile
+	segments int
+	failed   int
+	err      error
+	duration time.Duration
+}
+
+// expandInputs returns the subtitle files given on the command line. Folders are scanned recursively for
+// supported subtitle files other than the ones stgo writes, and so are the matches of glob patterns such as
+// "season1/*.srt". Files given explicitly are taken whatever their name.
+func expandInputs(args []string) ([]inputFile, error) {
+	var files []inputFile
+	seen := make(map[string]bool)
+	add := func(file inputFile) {
+		if key := filepath.Clean(file.path); !seen[key] {
+			seen[key] = true
+			files = append(files, file)
+		}
+	}
+
+	for _, arg := range args {
+		paths := []string{arg}
+		root := filepath.Dir(arg)
+		glob := strings.ContainsAny(arg, "*?[")
+		if glob {
+			var err error
+			if paths, err = filepath.Glob(arg); err != nil {
+				return nil, fmt.Errorf("%s: %w", arg, err)
+			}
+			if len(paths) == 0 {
+				return nil, fmt.Errorf("no file matches %s", arg)
+			}
+			root = globRoot(arg)
+		}
+
+		for _, path := range paths {
+			info, err := os.Stat(path)
+			if err != nil {
+				return nil, err
+			}
+			if !info.IsDir() {
+				if glob && !isSubtitleFile(path) {
+					continue
+				}
+				rel, err := filepath.Rel(root, path)
+				if err != nil {
+					return nil, err
+				}
+				add(inputFile{path, rel})
+				continue
+			}
+			found, err := scanFolder(path)
+			if err != nil {
+				return nil, err
+			}
+			prefix := ""
+			if glob {
+				// Folders matched by a pattern are mirrored from the pattern root, like the files it matches
+				if prefix, err = filepath.Rel(root, path); err != nil {
+					return nil, err
+				}
+			}
+			for _, file := range found {
+				add(inputFile{file.path, filepath.Join(prefix, file.rel)})
+			}
+		}
+	}
+	return files, nil
+}
+
+// scanFolder returns the subtitle files in a folder and its subfolders, relative to the folder.
+func scanFolder(dir string) ([]inputFile, error) {
+	var files []inputFile
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || !isSubtitleFile(path) {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, inputFile{path, rel})
+		return nil
+	})
+	return files, err
+}
+
+// isSubtitleFile reports whether a file has a supported subtitle extension and was not written by stgo.
+func isSubtitleFile(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	if _, ok := subtitleFormats[ext]; !ok {
+		return false
+	}
+	base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	for _, suffix := range generatedSuffixes {
+		if strings.HasSuffix(base, suffix) {
+			return false
+		}
+	}
+	return true
+}
+
+// globRoot returns the folder of a glob pattern before its first wildcard.
+func globRoot(pattern string) string {
+	static := pattern[:strings.IndexAny(pattern, "*?[")]
+	if i := strings.LastIndexAny(static, `/\`); i >= 0 {
+		return static[:i+1]
+	}
+	return "."
+}
+
+// configForFile returns a copy of the config for one input file. Outputs are named after the file, in the
+// output folder if one is set, and the title defaults to the file name.
+func configForFile(config *Config, file inputFile) Config {
+	fileConfig := *config
+	fileConfig.sourceSrt = file.path
+	ext := filepath.Ext(file.path)
+	fileConfig.outputBase = strings.TrimSuffix(file.path, ext)
+	if config.outDir != "" {
+		fileConfig.outputBase = filepath.Join(config.outDir, strings.TrimSuffix(file.rel, ext))
+	}
+	if config.title == "" {
+		fileConfig.title = strings.TrimSuffix(filepath.Base(file.path), ext)
+	}
+	return fileConfig
+}
+
+// translateFiles translates the files, up to parallelFiles at a time. The files share the rate limiters,
+// the translation memory and the usage counter of the config. With several files, the status of each file
+// is printed when it is done. With several files or an output folder, every file has its own report next to
+// its outputs.
+func translateFiles(files []inputFile, config *Config) []fileStatus {
+	statuses := make([]fileStatus, len(files))
+	jobs := make(chan int)
+	var mu sync.Mutex
+	done := 0
+
+	var wg sync.WaitGroup
+	for range max(min(config.parallelFiles, len(files)), 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				fileConfig := configForFile(config, files[i])
+				if (len(files) > 1 || config.outDir != "") && config.reportFile != "" {
+					fileConfig.reportFile = fileConfig.outputBase + "." + filepath.Base(config.reportFile)
+				}
+
+				start := time.Now()
+				segments, failed, err := translateFile(&fileConfig)
+				statuses[i] = fileStatus{files[i], segments, failed, err, time.Since(start)}
+
+				if len(files) > 1 {
+					mu.Lock()
+					done++
+					fmt.Printf("[%d/%d] %s: %s\n", done, len(files), files[i].path, statuses[i].describe())
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for i := range files {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return statuses
+}
+
+// translateFile translates one file into every target language, the languages running concurrently.
+// Returns the number of segments and the number of them that failed to translate.
+func translateFile(config *Config) (int, int, error) {
+	if err := os.MkdirAll(filepath.Dir(config.outputBase), 0755); err != nil {
+		return 0, 0, err
+	}
+	segments, reference, err := loadSegments(config)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// Translate into the pivot language once, it is shared by all target languages
+	var pivot []SrtSegment
+	if config.pivotLang != "" {
+		if pivot, err = translatePivot(segments, config); err != nil {
+			return len(segments), 0, err
+		}
+	}
+
+	languageConfigs := configsForTargetLanguages(config)
+	failures := make([]int, len(languageConfigs))
+	errs := make([]error, len(languageConfigs))
+	var wg sync.WaitGroup
+	for i := range languageConfigs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			failures[i], errs[i] = translateToFile(segments, reference, pivot, &languageConfigs[i])
+		}(i)
+	}
+	wg.Wait()
+
+	var failed int
+	for i, languageConfig := range languageConfigs {
+		if failures[i] > 0 {
+			fmt.Printf("%s: %d segments failed to translate\n", languageConfig.destSrt, failures[i])
+		}
+		failed += failures[i]
+	}
+	return len(segments), failed, errors.Join(errs...)
+}
+
+// describe summarizes the status of a file in one line.
+func (s fileStatus) describe() string {
+	switch {
+	case s.err != nil:
+		return fmt.Sprintf("error after %s: %v", s.duration.Round(time.Second), s.err)
+	case s.failed > 0:
+		return fmt.Sprintf("%d of %d segments failed to translate (%s)", s.failed, s.segments, s.duration.Round(time.Second))
+	default:
+		return fmt.Sprintf("done, %d segments (%s)", s.segments, s.duration.Round(time.Second))
+	}
+}
+
+// printBatchSummary prints the status of every file and the totals.
+func printBatchSummary(statuses []fileStatus) {
+	var segments, failedSegments, failedFiles int
+	fmt.Println("\nSummary:")
+	for _, status := range statuses {
+		fmt.Printf("  %s: %s\n", status.file.path, status.describe())
+		segments += status.segments
+		failedSegments += status.failed
+		if status.err != nil || status.failed > 0 {
+			failedFiles++
+		}
+	}
+	fmt.Printf("%d files, %d with problems, %d segments, %d failed to translate\n",
+		len(statuses), failedFiles, segments, failedSegments)
+}
+
+// batchError returns the error to exit with: the error of a single file, or a count of the files with problems.
+func batchError(statuses []fileStatus) error {
+	if len(statuses) == 1 {
+		if statuses[0].err != nil {
+			return statuses[0].err
+		}
+		if statuses[0].failed > 0 {
+			return fmt.Errorf("%d segments failed to translate", statuses[0].failed)
+		}
+		return nil
+	}
+
+	failedFiles := 0
+	for _, status := range statuses {
+		if status.err != nil || status.failed > 0 {
+			failedFiles++
+		}
+	}
+	if failedFiles > 0 {
+		return fmt.Errorf("%d of %d files failed", failedFiles, len(statuses))
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestExpandInputs(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.srt", "b.vtt", "a.openai.translated.srt", "notes.txt", "sub/c.srt", "sub/c.fixed.srt", "other/d.SRT"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want []string // Paths relative to dir, each also expected as the relative path of the input
+		rels []string // Expected relative paths of the inputs, if they differ from want
+		err  string   // Part of the expected error, if any
+	}{
+		{name: "folder", args: []string{dir}, want: []string{"a.srt", "b.vtt", "other/d.SRT", "sub/c.srt"}},
+		{name: "subfolder", args: []string{filepath.Join(dir, "sub")}, want: []string{"sub/c.srt"}, rels: []string{"c.srt"}},
+		{name: "file given explicitly", args: []string{filepath.Join(dir, "a.openai.translated.srt")}, want: []string{"a.openai.translated.srt"}},
+		{name: "glob", args: []string{filepath.Join(dir, "*", "*")}, want: []string{"other/d.SRT", "sub/c.srt"}},
+		{name: "glob of files and folders", args: []string{filepath.Join(dir, "[ns]*")}, want: []string{"sub/c.srt"}},
+		{name: "duplicates", args: []string{filepath.Join(dir, "a.srt"), filepath.Join(dir, "*.srt"), dir}, want: []string{"a.srt", "b.vtt", "other/d.SRT", "sub/c.srt"}},
+		{name: "no match", args: []string{filepath.Join(dir, "*.ass")}, err: "no file matches"},
+		{name: "missing file", args: []string{filepath.Join(dir, "missing.srt")}, err: "no such file"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			files, err := expandInputs(test.args)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("got error %v, want one containing %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var paths, rels []string
+			for _, file := range files {
+				path, err := filepath.Rel(dir, file.path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				paths = append(paths, filepath.ToSlash(path))
+				rels = append(rels, filepath.ToSlash(file.rel))
+			}
+			wantRels := test.rels
+			if wantRels == nil {
+				wantRels = test.want
+			}
+			if !slices.Equal(paths, test.want) {
+				t.Errorf("got files %q, want %q", paths, test.want)
+			}
+			if !slices.Equal(rels, wantRels) {
+				t.Errorf("got relative paths %q, want %q", rels, wantRels)
+			}
+		})
+	}
+}
+
+func TestGlobRoot(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    string
+	}{
+		{"*.srt", "."},
+		{"season1/*.srt", "season1/"},
+		{"shows/season?/ep*.srt", "shows/"},
+		{"/data/[ab]/*.vtt", "/data/"},
+		{`C:\subs\*.srt`, `C:\subs\`},
+		{"ep*/*.srt", "."},
+	}
+
+	for _, test := range tests {
+		if got := globRoot(test.pattern); got != test.want {
+			t.Errorf("globRoot(%q) = %q, want %q", test.pattern, got, test.want)
+		}
+	}
+}
+
+func TestIsSubtitleFile(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"show.srt", true},
+		{"show.VTT", true},
+		{"dir/show.ja.srt", true},
+		{"show.txt", false},
+		{"show", false},
+		{"show.openai.translated.srt", false},
+		{"show.openai.zh.translated.srt", false},
+		{"show.openai.en.pivot.srt", false},
+		{"show.removed.srt", false},
+		{"show.fixed.vtt", false},
+		{"show.timing.srt", false},
+		{"show.synced.srt", false},
+		{"translated.srt", true},
+	}
+
+	for _, test := range tests {
+		if got := isSubtitleFile(test.path); got != test.want {
+			t.Errorf("isSubtitleFile(%q) = %t, want %t", test.path, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// CandidateSelection records the candidate translations of a segment and which one was picked.
+type CandidateSelection struct {
+	Winner     int         `json:"winner"` // 1-based number of the picked candidate
+	Reason     string      `json:"reason"`
+	Candidates []Candidate `json:"candidates"`
+}
+
+// Candidate is one of the translations generated for a segment.
+type Candidate struct {
+	Backend string `json:"backend"`
+	Text    string `json:"text,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// candidateCount returns the number of candidate translations generated for each segment.
+func candidateCount(config *Config) int {
+	return max(config.candidates, len(splitList(config.candidateModels)))
+}
+
+// candidateConfigs returns the config of every candidate. Candidates cycle through the candidate models, or use
+// the main model. A model used by several candidates runs at the candidate temperature so that they differ.
+// Candidates share the rate limiter of the main translator.
+func candidateConfigs(config *Config) []Config {
+	models := splitList(config.candidateModels)
+	if len(models) == 0 {
+		models = []string{config.modelName}
+	}
+	count := candidateCount(config)
+
+	uses := make(map[string]int)
+	for k := 0; k < count; k++ {
+		uses[models[k%len(models)]]++
+	}
+
+	configs := make([]Config, count)
+	for k := range configs {
+		configs[k] = *config
+		configs[k].modelName = models[k%len(models)]
+		configs[k].memory = nil // Identical candidates from the memory would defeat the purpose
+		if uses[configs[k].modelName] > 1 {
+			configs[k].temperature = config.candidateTemperature
+		}
+	}
+	return configs
+}
+
+// translateCandidates translates the segments once per candidate and picks one translation per segment,
+// either by agreement between the candidates or by asking a judge model. The selection is recorded in
+// the Candidates field of each segment.
+func translateCandidates(segments []SrtSegment, referenceSegments []SrtSegment, config *Config) []SrtSegment {
+	configs := candidateConfigs(config)
+	candidates := make([][]SrtSegment, len(configs))
+
+	var wg sync.WaitGroup
+	for k := range configs {
+		wg.Add(1)
+		go func(k int) {
+			defer wg.Done()
+			candidates[k] = translateSrtSegmentsInBatches(segments, referenceSegments, &configs[k])
+		}(k)
+	}
+	wg.Wait()
+
+	// A candidate whose translation was aborted counts as failed for every segment
+	for k := range candidates {
+		if candidates[k] == nil {
+			candidates[k] = make([]SrtSegment, len(segments))
+			copy(candidates[k], segments)
+			for i := range candidates[k] {
+				candidates[k][i].Backend = backendName(&configs[k])
+				candidates[k][i].Err = fmt.Errorf("translation aborted")
+			}
+		}
+	}
+
+	var judged map[int]int
+	if config.judgeBackend != nil {
+		judged = judgeCandidates(segments, candidates, config)
+	}
+
+	results := make([]SrtSegment, len(segments))
+	for i := range segments {
+		selection := &CandidateSelection{}
+		var successful []int
+		for k := range candidates {
+			candidate := Candidate{Backend: candidates[k][i].Backend}
+			if candidates[k][i].Err != nil {
+				candidate.Error = candidates[k][i].Err.Error()
+			} else {
+				candidate.Text = candidates[k][i].Text
+				successful = append(successful, k)
+			}
+			selection.Candidates = append(selection.Candidates, candidate)
+		}
+
+		winner := 0
+		switch {
+		case len(successful) == 0:
+			selection.Reason = "all candidates failed"
+		case len(successful) == 1:
+			winner = successful[0]
+			selection.Reason = "only successful candidate"
+		case judged[i] > 0:
+			winner = judged[i] - 1
+			selection.Reason = "chosen by the judge " + backendName(config.judgeBackend)
+		default:
+			var agreement float64
+			winner, agreement = mostAgreedCandidate(candidates, successful, i)
+			selection.Reason = fmt.Sprintf("highest agreement with the other candidates (%.2f)", agreement)
+			if config.judgeBackend != nil {
+				selection.Reason += ", the judge gave no valid answer"
+			}
+		}
+
+		results[i] = candidates[winner][i]
+		results[i].Attempts = 0
+		for k := range candidates {
+			results[i].Attempts += candidates[k][i].Attempts
+		}
+		selection.Winner = winner + 1
+		results[i].Candidates = selection
+	}
+
+	return results
+}
+
+// mostAgreedCandidate returns the successful candidate of segment i with the highest average similarity to
+// the other successful candidates, and that similarity. Ties go to the first candidate.
+func mostAgreedCandidate(candidates [][]SrtSegment, successful []int, i int) (int, float64) {
+	best, bestAgreement := successful[0], -1.0
+	for _, k := range successful {
+		var total float64
+		for _, other := range successful {
+			if other != k {
+				total += textSimilarity(candidates[k][i].Text, candidates[other][i].Text)
+			}
+		}
+		agreement := total / float64(len(successful)-1)
+		if agreement > bestAgreement {
+			best, bestAgreement = k, agreement
+		}
+	}
+	return best, bestAgreement
+}
+
+// judgeCandidates asks the judge model to pick the best candidate of every segment with at least two
+// successful candidates. Returns the 1-based number of the picked candidate by segment index.
+func judgeCandidates(segments []SrtSegment, candidates [][]SrtSegment, config *Config) map[int]int {
+	judgeConfig := *config.judgeBackend
+	judgeConfig.sourceLang = config.sourceLang
+	judgeConfig.targetLang = config.targetLang
+
+	// Each segment lists the source followed by the numbered candidates
+	var questions []SrtSegment
+	var indices []int
+	valid := make(map[int]map[int]bool)
+	for i, segment := range segments {
+		var lines []string
+		options := make(map[int]bool)
+		for k := range candidates {
+			if candidates[k][i].Err == nil {
+				lines = append(lines, fmt.Sprintf("[%d] %s", k+1, strings.ReplaceAll(candidates[k][i].Text, "\n", " ")))
+				options[k+1] = true
+			}
+		}
+		if len(options) < 2 {
+			continue
+		}
+		questions = append(questions, SrtSegment{
+			ID:   segment.ID,
+			Time: segment.Time,
+			Text: strings.ReplaceAll(segment.Text, "\n", " ") + "\n" + strings.Join(lines, "\n"),
+		})
+		indices = append(indices, i)
+		valid[i] = options
+	}
+	if len(questions) == 0 {
+		return nil
+	}
+
+	fmt.Printf("Judging the %s candidates with %s\n", config.targetLang, backendName(&judgeConfig))
+	answers := translateSrtSegmentsInBatches(questions, nil, &judgeConfig)
+	judged := make(map[int]int)
+	for n, i := range indices {
+		if answers == nil || answers[n].Err != nil {
+			continue
+		}
+		if choice, ok := parseJudgeAnswer(answers[n].Text, valid[i]); ok {
+			judged[i] = choice
+		}
+	}
+	return judged
+}
+
+// parseJudgeAnswer reads the candidate number answered by the judge, such as "2" or "[2]", and reports whether
+// it is one of the valid choices.
+func parseJudgeAnswer(answer string, valid map[int]bool) (int, bool) {
+	choice, err := strconv.Atoi(strings.Trim(strings.TrimSpace(answer), "[]"))
+	return choice, err == nil && valid[choice]
+}
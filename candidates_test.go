@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestMostAgreedCandidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		texts      []string
+		successful []int
+		want       int
+	}{
+		{"majority", []string{"Good morning", "Hello there", "Good morning!"}, []int{0, 1, 2}, 0},
+		{"closest to the others", []string{"Hello", "Good morning everyone", "Good morning all", "Good evening all"}, []int{0, 1, 2, 3}, 2},
+		{"tie goes to the first", []string{"abc", "xyz"}, []int{0, 1}, 0},
+		{"failed candidates ignored", []string{"Good morning", "Hello there", "Hello there!"}, []int{1, 2}, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			candidates := make([][]SrtSegment, len(test.texts))
+			for k, text := range test.texts {
+				candidates[k] = []SrtSegment{{Text: "other"}, {Text: text}}
+			}
+			if got, _ := mostAgreedCandidate(candidates, test.successful, 1); got != test.want {
+				t.Errorf("got candidate %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseJudgeAnswer(t *testing.T) {
+	valid := map[int]bool{1: true, 3: true}
+	tests := []struct {
+		answer string
+		want   int
+		ok     bool
+	}{
+		{"1", 1, true},
+		{" [3]\n", 3, true},
+		{"2", 2, false},
+		{"[4]", 4, false},
+		{"Candidate 1", 0, false},
+		{"", 0, false},
+	}
+
+	for _, test := range tests {
+		if got, ok := parseJudgeAnswer(test.answer, valid); got != test.want || ok != test.ok {
+			t.Errorf("parseJudgeAnswer(%q) = %d, %t, want %d, %t", test.answer, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestJudgeCandidates(t *testing.T) {
+	segments := segmentsOf(
+		"00:00:01,000 --> 00:00:02,000", "Bonjour",
+		"00:00:03,000 --> 00:00:04,000", "Merci",
+		"00:00:05,000 --> 00:00:06,000", "Salut",
+	)
+	candidates := [][]SrtSegment{
+		{{Text: "Good day"}, {Text: "Thanks"}, {Text: "Hi"}},
+		{{Text: "Hello"}, {Text: "Thank you"}, {Err: errors.New("failed")}},
+	}
+	// The judge picks the second candidate of the first segment, and an invalid one for the second segment
+	config := Config{judgeBackend: fakeBackend("judge", func(text, _ string) string {
+		if strings.HasPrefix(text, "Bonjour\n") {
+			return "[2]"
+		}
+		return "5"
+	})}
+
+	judged := judgeCandidates(segments, candidates, &config)
+	if len(judged) != 1 || judged[0] != 2 {
+		t.Errorf("got %v, want the second candidate of the first segment only", judged)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Example is a source line and its model translation, shown to the AI as a previous exchange.
+type Example struct {
+	Source      string `yaml:"source"`
+	Translation string `yaml:"translation"`
+}
+
+// loadExamples reads a YAML examples file, a list of entries with a source and a translation.
+func loadExamples(path string) ([]Example, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var examples []Example
+	if err := yaml.Unmarshal(data, &examples); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for i, example := range examples {
+		if example.Source == "" || example.Translation == "" {
+			return nil, fmt.Errorf("%s: example %d needs a source and a translation", path, i+1)
+		}
+	}
+	return examples, nil
+}
+
+// selectExamples returns the k examples most similar to the segments, in the order of the file, or all of them
+// if k is not positive. The similarity of an example is its best textSimilarity with any of the segments.
+func selectExamples(examples []Example, segments []SrtSegment, k int) []Example {
+	if k <= 0 || k >= len(examples) {
+		return examples
+	}
+
+	scores := make([]float64, len(examples))
+	for i, example := range examples {
+		for _, segment := range segments {
+			scores[i] = max(scores[i], textSimilarity(example.Source, segment.Text))
+		}
+	}
+	order := make([]int, len(examples))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int { return cmp.Compare(scores[b], scores[a]) })
+	order = order[:k]
+	slices.Sort(order)
+
+	selected := make([]Example, k)
+	for n, i := range order {
+		selected[n] = examples[i]
+	}
+	return selected
+}
+
+// exampleMessages returns the examples as user and assistant turns. Each example is sent as a request of its
+// own, written by the given prompt function, and answered with its translation in the expected format.
+func exampleMessages(examples []Example, prompt func(request TranslationRequest) (string, error)) ([]ChatMessage, error) {
+	var messages []ChatMessage
+	for _, example := range examples {
+		segment := SrtSegment{ID: "1", Time: "00:00:01,000 --> 00:00:03,000", Text: example.Source}
+		content, err := prompt(TranslationRequest{Text: formatSegment(segment), Segments: []SrtSegment{segment}})
+		if err != nil {
+			return nil, err
+		}
+		segment.Text = example.Translation
+		messages = append(messages,
+			ChatMessage{Role: "user", Content: strings.TrimSpace(content)},
+			ChatMessage{Role: "assistant", Content: formatSegment(segment)})
+	}
+	return messages, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSelectExamples(t *testing.T) {
+	examples := []Example{
+		{Source: "Where is the station?", Translation: "駅はどこですか？"},
+		{Source: "I love you", Translation: "愛してる"},
+		{Source: "Good morning, everyone", Translation: "皆さん、おはようございます"},
+		{Source: "Where is my bag?", Translation: "私のかばんはどこ？"},
+	}
+	tests := []struct {
+		name     string
+		segments []string
+		k        int
+		want     []string // Sources of the selected examples
+	}{
+		{"all without a limit", []string{"Where is it?"}, 0, []string{"Where is the station?", "I love you", "Good morning, everyone", "Where is my bag?"}},
+		{"all when k is the count", []string{"Where is it?"}, 4, []string{"Where is the station?", "I love you", "Good morning, everyone", "Where is my bag?"}},
+		{"most similar", []string{"Where is my phone?"}, 1, []string{"Where is my bag?"}},
+		{"kept in file order", []string{"Where is my phone?"}, 2, []string{"Where is the station?", "Where is my bag?"}},
+		{"best match over the segments", []string{"Where is my phone?", "Good morning"}, 2, []string{"Good morning, everyone", "Where is my bag?"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			segments := make([]SrtSegment, len(test.segments))
+			for i, text := range test.segments {
+				segments[i] = SrtSegment{Text: text}
+			}
+			var got []string
+			for _, example := range selectExamples(examples, segments, test.k) {
+				got = append(got, example.Source)
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestLoadExamples(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    int
+		err     string // Part of the expected error, if any
+	}{
+		{name: "examples", content: "- source: Hello\n  translation: 你好\n- source: |\n    Two\n    lines\n  translation: 两行\n", want: 2},
+		{name: "empty", content: "", want: 0},
+		{name: "missing translation", content: "- source: Hello\n", err: "example 1 needs a source and a translation"},
+		{name: "not a list", content: "source: Hello\n", err: "cannot unmarshal"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "examples.yaml")
+			if err := os.WriteFile(path, []byte(test.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			examples, err := loadExamples(path)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("got error %v, want one containing %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(examples) != test.want {
+				t.Errorf("got %d examples, want %d", len(examples), test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Supported subtitle formats, by file extension. Segments always hold SRT-style time lines, whatever the format.
+var subtitleFormats = map[string]struct {
+	read func(filePath string) ([]SrtSegment, error)
+	save func(translatedSegments, originalSegments []SrtSegment, filePath string, bilingual bool) error
+}{
+	".srt": {readSrtFile, saveSrtFile},
+	".vtt": {readVttFile, saveVttFile},
+}
+
+// subtitleFormat returns the format of a file from its extension. Unknown extensions are read as SRT.
+func subtitleFormat(filePath string) string {
+	ext := strings.ToLower(filepath.Ext(filePath))
+	if _, ok := subtitleFormats[ext]; ok {
+		return ext
+	}
+	return ".srt"
+}
+
+// readSubtitleFile reads a subtitle file in any supported format.
+func readSubtitleFile(filePath string) ([]SrtSegment, error) {
+	return subtitleFormats[subtitleFormat(filePath)].read(filePath)
+}
+
+// saveSubtitleFile saves subtitles in the format given by the file extension, which must be a supported one.
+func saveSubtitleFile(translatedSegments, originalSegments []SrtSegment, filePath string, bilingual bool) error {
+	format, ok := subtitleFormats[strings.ToLower(filepath.Ext(filePath))]
+	if !ok {
+		return fmt.Errorf("unsupported output format of %s, options: srt, vtt", filePath)
+	}
+	return format.save(translatedSegments, originalSegments, filePath, bilingual)
+}
+
+// readVttFile reads a WebVTT file. NOTE, STYLE and REGION blocks are skipped and cue settings are dropped.
+// Cues are numbered by position, their identifier being kept in CueID, since the translation response parser
+// only accepts numeric IDs.
+func readVttFile(filePath string) ([]SrtSegment, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var blocks [][]string
+	var block []string
+	scanner := bufio.NewScanner(file)
+	for first := true; scanner.Scan(); first = false {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if first {
+			line = strings.TrimPrefix(line, "\uFEFF")
+			if !strings.HasPrefix(line, "WEBVTT") {
+				return nil, fmt.Errorf("%s: missing WEBVTT header", filePath)
+			}
+		}
+		if strings.TrimSpace(line) == "" {
+			if block != nil {
+				blocks = append(blocks, block)
+				block = nil
+			}
+			continue
+		}
+		block = append(block, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if block != nil {
+		blocks = append(blocks, block)
+	}
+
+	var results []SrtSegment
+	for _, block := range blocks {
+		// The header block, comments and style definitions have no time line
+		timeIndex := -1
+		for i, line := range block[:min(2, len(block))] {
+			if strings.Contains(line, "-->") {
+				timeIndex = i
+				break
+			}
+		}
+		if timeIndex < 0 {
+			continue
+		}
+
+		start, end, err := parseTimeRange(block[timeIndex])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filePath, err)
+		}
+		segment := SrtSegment{
+			ID:   strconv.Itoa(len(results) + 1),
+			Time: formatTimeRange(start, end),
+			Text: strings.Join(block[timeIndex+1:], "\n"),
+		}
+		if timeIndex == 1 {
+			segment.CueID = block[0]
+		}
+		results = append(results, segment)
+	}
+	return results, nil
+}
+
+// saveVttFile saves subtitles as WebVTT, with the original text above the translation if bilingual. The cue
+// identifiers of the original segments are restored.
+func saveVttFile(translatedSegments []SrtSegment, originalSegments []SrtSegment, filePath string, bilingual bool) error {
+	file, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	writer.WriteString("WEBVTT\n\n")
+	for i, segment := range translatedSegments {
+		timeLine := segment.Time
+		if start, end, err := parseTimeRange(segment.Time); err == nil {
+			timeLine = strings.ReplaceAll(formatTimeRange(start, end), ",", ".")
+		}
+		id := segment.ID
+		if len(originalSegments) > i && originalSegments[i].CueID != "" {
+			id = originalSegments[i].CueID
+		}
+		text := segment.Text
+		if bilingual && len(originalSegments) > i {
+			text = originalSegments[i].Text + "\n" + text
+		}
+		fmt.Fprintf(writer, "%s\n%s\n%s\n\n", id, timeLine, text)
+	}
+	return writer.Flush()
+}
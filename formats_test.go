@@ -0,0 +1,93 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestVttRoundTrip(t *testing.T) {
+	input := "\uFEFFWEBVTT - title\n\nNOTE a comment\nover two lines\n\nSTYLE\n::cue { color: yellow }\n\n" +
+		"intro\n00:00:01.000 --> 00:00:02.500 align:start\nHello\nthere\n\n" +
+		"00:01:02.000 --> 00:01:03.000\nSecond\n\n" +
+		"3\r\n01:00:00.000 --> 01:00:01.000\r\nThird\r\n"
+	dir := t.TempDir()
+	path := filepath.Join(dir, "input.vtt")
+	if err := os.WriteFile(path, []byte(input), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	segments, err := readSubtitleFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids, cueIDs, times, texts []string
+	for _, segment := range segments {
+		ids = append(ids, segment.ID)
+		cueIDs = append(cueIDs, segment.CueID)
+		times = append(times, segment.Time)
+		texts = append(texts, segment.Text)
+	}
+	if want := []string{"1", "2", "3"}; !slices.Equal(ids, want) {
+		t.Errorf("got IDs %q, want %q", ids, want)
+	}
+	if want := []string{"intro", "", "3"}; !slices.Equal(cueIDs, want) {
+		t.Errorf("got cue identifiers %q, want %q", cueIDs, want)
+	}
+	if want := []string{"00:00:01,000 --> 00:00:02,500", "00:01:02,000 --> 00:01:03,000", "01:00:00,000 --> 01:00:01,000"}; !slices.Equal(times, want) {
+		t.Errorf("got times %q, want %q", times, want)
+	}
+	if want := []string{"Hello\nthere", "Second", "Third"}; !slices.Equal(texts, want) {
+		t.Errorf("got texts %q, want %q", texts, want)
+	}
+
+	// The translation response only carries the numeric IDs, the cue identifiers are restored when saving
+	translated := make([]SrtSegment, len(segments))
+	for i, segment := range segments {
+		translated[i] = SrtSegment{ID: segment.ID, Time: segment.Time, Text: "[" + segment.Text + "]"}
+	}
+	output := filepath.Join(dir, "output.vtt")
+	if err := saveSubtitleFile(translated, segments, output, false); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "WEBVTT\n\nintro\n00:00:01.000 --> 00:00:02.500\n[Hello\nthere]\n\n" +
+		"2\n00:01:02.000 --> 00:01:03.000\n[Second]\n\n" +
+		"3\n01:00:00.000 --> 01:00:01.000\n[Third]\n\n"
+	if string(data) != want {
+		t.Errorf("saved %q, want %q", data, want)
+	}
+}
+
+func TestReadVttFileWithoutHeader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "input.vtt")
+	if err := os.WriteFile(path, []byte("1\n00:00:01,000 --> 00:00:02,000\nHello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readSubtitleFile(path); err == nil {
+		t.Error("got no error for a file without the WEBVTT header")
+	}
+}
+
+func TestSaveSubtitleFileFormats(t *testing.T) {
+	segments := segmentsOf("00:00:01,000 --> 00:00:02,000", "Hello")
+	dir := t.TempDir()
+	for _, name := range []string{"out.srt", "out.vtt", "OUT.VTT"} {
+		if err := saveSubtitleFile(segments, segments, filepath.Join(dir, name), false); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	for _, name := range []string{"out.ass", "out"} {
+		path := filepath.Join(dir, name)
+		if err := saveSubtitleFile(segments, segments, path, false); err == nil {
+			t.Errorf("%s: got no error for an unsupported format", name)
+		}
+		if _, err := os.Stat(path); err == nil {
+			t.Errorf("%s: file written despite the unsupported format", name)
+		}
+	}
+}
@@ -6,10 +6,11 @@ require (
 	github.com/Conight/go-googletrans v0.2.4
 	github.com/dlclark/regexp2 v1.11.1
 	github.com/spf13/cobra v1.8.1
+	github.com/spf13/pflag v1.0.5
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
-	github.com/spf13/pflag v1.0.5 // indirect
 	golang.org/x/text v0.22.0
 )
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Phrases Whisper is known to produce during silence, by source language. Phrases listed under "" apply to
+// every language.
+var hallucinationPhrases = map[string][]string{
+	"": {
+		"Subtitles by the Amara.org community",
+	},
+	"ja": {
+		"ご視聴ありがとうございました",
+		"ご視聴ありがとうございます",
+		"最後までご視聴いただきありがとうございました",
+		"チャンネル登録お願いします",
+		"チャンネル登録よろしくお願いします",
+		"チャンネル登録と高評価をお願いします",
+	},
+	"en": {
+		"Thanks for watching",
+		"Thank you for watching",
+		"Thank you so much for watching",
+		"Please subscribe",
+		"Subscribe to my channel",
+		"Like and subscribe",
+		"Don't forget to like and subscribe",
+	},
+	"zh": {
+		"谢谢观看",
+		"感谢观看",
+		"谢谢大家观看",
+		"请不吝点赞 订阅 转发 打赏支持明镜与点点栏目",
+		"字幕由Amara.org社区提供",
+		"订阅我的频道",
+	},
+	"ko": {
+		"시청해주셔서 감사합니다",
+		"구독과 좋아요 부탁드립니다",
+	},
+}
+
+const (
+	maxDuplicateCues               = 2                // Identical consecutive cues kept before the rest are removed
+	defaultMaxPlausibleCPS         = 30               // Readable characters per second no one can speak
+	minFastCueLength               = 5                // Shorter cues are never too fast, Whisper often gives them a few milliseconds
+	minSuspiciousDuration          = 15 * time.Second // Cues at least this long with very little text are suspicious
+	defaultMinPlausibleCPSLongCues = 0.2
+)
+
+// RemovedSegment is a segment removed by the hallucination filter, and why.
+type RemovedSegment struct {
+	Segment SrtSegment
+	Reason  string
+}
+
+// filterHallucinations removes the segments that are likely hallucinations: known phrases of the source language,
+// identical lines repeated across consecutive cues, and text implausibly long or short for the duration: more
+// than maxCPS readable characters per second in a cue of at least minFastCueLength characters, or less than
+// minLongCPS in a cue lasting minSuspiciousDuration or more. The IDs of the remaining segments are renumbered
+// to be sequential starting from 1.
+func filterHallucinations(segments []SrtSegment, phrases []string, maxCPS, minLongCPS float64) ([]SrtSegment, []RemovedSegment) {
+	normalizedPhrases := make([]string, 0, len(phrases))
+	for _, phrase := range phrases {
+		if normalized := normalizeForComparison(phrase); normalized != "" {
+			normalizedPhrases = append(normalizedPhrases, normalized)
+		}
+	}
+
+	results := make([]SrtSegment, 0, len(segments))
+	var removed []RemovedSegment
+	previous, repeats := "", 0
+	for _, segment := range segments {
+		normalized := normalizeForComparison(segment.Text)
+		if normalized != "" && normalized == previous {
+			repeats++
+		} else {
+			previous, repeats = normalized, 1
+		}
+
+		reason := ""
+		start, end, err := parseTimeRange(segment.Time)
+		if repeats > maxDuplicateCues {
+			reason = fmt.Sprintf("repeated in more than %d consecutive cues", maxDuplicateCues)
+		} else if phrase := matchHallucinationPhrase(normalized, normalizedPhrases); phrase != "" {
+			reason = "known hallucination phrase"
+		} else if err == nil && end > start {
+			length := readableLength(segment.Text)
+			cps := float64(length) / (end - start).Seconds()
+			if cps > maxCPS && length >= minFastCueLength {
+				reason = fmt.Sprintf("%.1f characters per second, too fast to be speech", cps)
+			} else if end-start >= minSuspiciousDuration && cps < minLongCPS {
+				reason = fmt.Sprintf("%d characters in %s, too little for the duration", length, end-start)
+			}
+		}
+
+		if reason != "" {
+			removed = append(removed, RemovedSegment{Segment: segment, Reason: reason})
+			continue
+		}
+		segment.ID = fmt.Sprintf("%d", len(results)+1)
+		results = append(results, segment)
+	}
+
+	return results, removed
+}
+
+// matchHallucinationPhrase returns the phrase making up most of the normalized text, if any.
+func matchHallucinationPhrase(normalized string, phrases []string) string {
+	if normalized == "" {
+		return ""
+	}
+	for _, phrase := range phrases {
+		if strings.Contains(normalized, phrase) && utf8.RuneCountInString(phrase)*3 >= utf8.RuneCountInString(normalized)*2 {
+			return phrase
+		}
+	}
+	return ""
+}
+
+// loadHallucinationPhrases returns the built-in phrases for the language, followed by those read from the given
+// file if any. The file lists one phrase per line. Phrases after a line such as "[ja]" only apply to that
+// language, phrases before any such line apply to every language. Empty lines and lines starting with # are
+// ignored.
+func loadHallucinationPhrases(lang string, filePath string) ([]string, error) {
+	lang = baseLanguage(lang)
+	phrases := append(append([]string{}, hallucinationPhrases[""]...), hallucinationPhrases[lang]...)
+	if filePath == "" {
+		return phrases, nil
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	section := ""
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			section = baseLanguage(strings.TrimSpace(line[1 : len(line)-1]))
+		case section == "" || section == lang:
+			phrases = append(phrases, line)
+		}
+	}
+	return phrases, scanner.Err()
+}
+
+// writeRemovedLog writes the removed segments as plain text, one line per segment with its ID, time line,
+// the reason of its removal and its text.
+func writeRemovedLog(filePath string, removed []RemovedSegment) error {
+	file, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	for _, r := range removed {
+		text := strings.ReplaceAll(r.Segment.Text, "\n", " / ")
+		if _, err := fmt.Fprintf(file, "%s\t%s\t%s\t%s\n", r.Segment.ID, r.Segment.Time, r.Reason, text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
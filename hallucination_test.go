@@ -0,0 +1,135 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestFilterHallucinations(t *testing.T) {
+	phrases := []string{"Thanks for watching", "ご視聴ありがとうございました", "!!!"}
+	tests := []struct {
+		name     string
+		segments []SrtSegment
+		kept     []string // Texts of the kept segments
+		reasons  []string // Start of the reason of each removed segment
+	}{
+		{
+			name:     "known phrase",
+			segments: segmentsOf("00:00:01,000 --> 00:00:03,000", "Hello", "00:00:05,000 --> 00:00:07,000", "Thanks for watching!"),
+			kept:     []string{"Hello"},
+			reasons:  []string{"known hallucination phrase"},
+		},
+		{
+			name:     "known phrase with little else",
+			segments: segmentsOf("00:00:01,000 --> 00:00:03,000", "ご視聴ありがとうございました。"),
+			reasons:  []string{"known hallucination phrase"},
+		},
+		{
+			name:     "known phrase within a longer line",
+			segments: segmentsOf("00:00:01,000 --> 00:00:05,000", "Thanks for watching the game with me tonight"),
+			kept:     []string{"Thanks for watching the game with me tonight"},
+		},
+		{
+			name: "repeated cues",
+			segments: segmentsOf(
+				"00:00:01,000 --> 00:00:02,000", "Hello",
+				"00:00:02,000 --> 00:00:03,000", "hello!",
+				"00:00:03,000 --> 00:00:04,000", "Hello",
+				"00:00:04,000 --> 00:00:05,000", "Hello",
+				"00:00:05,000 --> 00:00:06,000", "Bye",
+				"00:00:06,000 --> 00:00:07,000", "Hello",
+			),
+			kept:    []string{"Hello", "hello!", "Bye", "Hello"},
+			reasons: []string{"repeated in more than 2 consecutive cues", "repeated"},
+		},
+		{
+			name:     "too fast",
+			segments: segmentsOf("00:00:01,000 --> 00:00:01,500", "This cannot be said so fast", "00:00:02,000 --> 00:00:02,010", "Oh"),
+			kept:     []string{"Oh"},
+			reasons:  []string{"44.0 characters per second"},
+		},
+		{
+			name:     "too little text for a long cue",
+			segments: segmentsOf("00:00:01,000 --> 00:00:21,000", "Oh", "00:00:30,000 --> 00:00:45,000", "A long speech of many words"),
+			kept:     []string{"A long speech of many words"},
+			reasons:  []string{"2 characters in 20s"},
+		},
+		{
+			name:     "unreadable time line kept",
+			segments: segmentsOf("bad", "Hello"),
+			kept:     []string{"Hello"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			kept, removed := filterHallucinations(test.segments, phrases, defaultMaxPlausibleCPS, defaultMinPlausibleCPSLongCues)
+			var texts []string
+			for i, segment := range kept {
+				texts = append(texts, segment.Text)
+				if want := strconv.Itoa(i + 1); segment.ID != want {
+					t.Errorf("kept segment %d has ID %q, want %q", i, segment.ID, want)
+				}
+			}
+			if !slices.Equal(texts, test.kept) {
+				t.Errorf("kept %q, want %q", texts, test.kept)
+			}
+			if len(removed) != len(test.reasons) {
+				t.Fatalf("removed %+v, want %d segments", removed, len(test.reasons))
+			}
+			for i, r := range removed {
+				if !strings.HasPrefix(r.Reason, test.reasons[i]) {
+					t.Errorf("removed %q because %q, want %q", r.Segment.Text, r.Reason, test.reasons[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLoadHallucinationPhrases(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "phrases.txt")
+	content := "# Own phrases\nEvery language\n\n[ja]\nJapanese only\n[en-US]\nEnglish only\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		lang     string
+		file     string
+		contains []string
+		excludes []string
+	}{
+		{"built-in", "en", "", []string{"Subtitles by the Amara.org community", "Thanks for watching"}, []string{"谢谢观看"}},
+		{"unknown language", "xx", "", []string{"Subtitles by the Amara.org community"}, []string{"Thanks for watching"}},
+		{"file sections by base language", "en-GB", path, []string{"Thanks for watching", "Every language", "English only"}, []string{"Japanese only", "# Own phrases", ""}},
+		{"other section", "ja", path, []string{"ご視聴ありがとうございました", "Every language", "Japanese only"}, []string{"English only", "[ja]"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			phrases, err := loadHallucinationPhrases(test.lang, test.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, phrase := range test.contains {
+				if !slices.Contains(phrases, phrase) {
+					t.Errorf("got %q, want %q among them", phrases, phrase)
+				}
+			}
+			for _, phrase := range test.excludes {
+				if slices.Contains(phrases, phrase) {
+					t.Errorf("got %q, want no %q", phrases, phrase)
+				}
+			}
+		})
+	}
+
+	if _, err := loadHallucinationPhrases("en", filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("got no error for a missing file")
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// scriptsByLanguage lists the scripts a translation into the given language is expected to be written in.
+// Languages not listed here only get the echo check.
+var scriptsByLanguage = map[string][]*unicode.RangeTable{
+	"zh": {unicode.Han},
+	"ja": {unicode.Han, unicode.Hiragana, unicode.Katakana},
+	"ko": {unicode.Hangul},
+	"en": {unicode.Latin},
+	"fr": {unicode.Latin},
+	"de": {unicode.Latin},
+	"es": {unicode.Latin},
+	"pt": {unicode.Latin},
+	"it": {unicode.Latin},
+	"nl": {unicode.Latin},
+	"id": {unicode.Latin},
+	"ms": {unicode.Latin},
+	"vi": {unicode.Latin},
+	"tr": {unicode.Latin},
+	"pl": {unicode.Latin},
+	"ru": {unicode.Cyrillic},
+	"uk": {unicode.Cyrillic},
+	"th": {unicode.Thai},
+	"ar": {unicode.Arabic},
+	"fa": {unicode.Arabic},
+}
+
+// checkLanguage verifies that a translated segment is written in the target language.
+// It detects translations that echo the source text and translations written in the wrong script,
+// e.g. Japanese or English output when the target language is Chinese.
+// Segments with too few letters to be judged always pass.
+func checkLanguage(sourceText, translatedText string, config *Config) error {
+	if !config.languageCheck {
+		return nil
+	}
+
+	source := normalizeForComparison(sourceText)
+	translated := normalizeForComparison(translatedText)
+	if countLetters(source) < 2 || countLetters(translated) < 2 {
+		return nil
+	}
+
+	// Exact echo of the source text. Han-only text may legitimately be identical between Japanese and Chinese.
+	if source == translated && baseLanguage(config.sourceLang) != baseLanguage(config.targetLang) &&
+		countLetters(source) >= 6 && strings.IndexFunc(source, func(r rune) bool {
+		return unicode.IsLetter(r) && !unicode.Is(unicode.Han, r)
+	}) >= 0 {
+		return fmt.Errorf("translation is identical to the source text")
+	}
+
+	target := baseLanguage(config.targetLang)
+	expected, ok := scriptsByLanguage[target]
+	if !ok {
+		return nil
+	}
+
+	var expectedWeight, totalWeight, han, kana int
+	for _, r := range translated {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		// A CJK character carries roughly as much meaning as a short word in alphabetic scripts
+		weight := 1
+		if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) {
+			weight = 2
+		}
+		if unicode.Is(unicode.Han, r) {
+			han++
+		}
+		if unicode.In(r, unicode.Hiragana, unicode.Katakana) {
+			kana++
+		}
+		if unicode.In(r, expected...) {
+			expectedWeight += weight
+		}
+		totalWeight += weight
+	}
+
+	if float64(expectedWeight)/float64(totalWeight) < 0.3 {
+		return fmt.Errorf("translation does not look like %s", config.targetLang)
+	}
+	// Han is shared by Chinese and Japanese, so tell them apart by the amount of kana.
+	switch target {
+	case "zh":
+		if kana >= 2 && float64(kana)/float64(han+kana) > 0.1 {
+			return fmt.Errorf("translation contains Japanese kana, expected %s", config.targetLang)
+		}
+	case "ja":
+		if kana == 0 && han >= 8 {
+			return fmt.Errorf("translation contains no kana, it looks like Chinese rather than %s", config.targetLang)
+		}
+	}
+
+	return nil
+}
+
+// baseLanguage returns the lowercase primary subtag of a language code, e.g. "zh" for "zh-CN".
+func baseLanguage(lang string) string {
+	lang = strings.ToLower(lang)
+	if i := strings.IndexAny(lang, "-_"); i >= 0 {
+		lang = lang[:i]
+	}
+	return lang
+}
+
+// normalizeForComparison applies NFKC and removes everything except letters and digits.
+func normalizeForComparison(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, norm.NFKC.String(s))
+}
+
+func countLetters(s string) int {
+	count := 0
+	for _, r := range s {
+		if unicode.IsLetter(r) {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckLanguage(t *testing.T) {
+	tests := []struct {
+		name       string
+		source     string
+		translated string
+		sourceLang string
+		targetLang string
+		err        string // Part of the expected error, if any
+	}{
+		{name: "chinese", source: "Thank you very much", translated: "非常感谢你", sourceLang: "en", targetLang: "zh"},
+		{name: "chinese with a region", source: "Thank you very much", translated: "非常感谢你", sourceLang: "en", targetLang: "zh-CN"},
+		{name: "chinese with a brand name", source: "I like Netflix", translated: "我喜欢Netflix", sourceLang: "en", targetLang: "zh"},
+		{name: "kana instead of chinese", source: "Thank you very much", translated: "ありがとうございます", sourceLang: "en", targetLang: "zh", err: "does not look like zh"},
+		{name: "japanese instead of chinese", source: "I am a student", translated: "私は東京大学の学生です", sourceLang: "en", targetLang: "zh", err: "kana"},
+		{name: "single kana in chinese", source: "This is a test", translated: "这是ノ测试一下吧", sourceLang: "en", targetLang: "zh"},
+		{name: "japanese", source: "Thank you very much", translated: "どうもありがとう", sourceLang: "en", targetLang: "ja"},
+		{name: "chinese instead of japanese", source: "We are going to dinner tonight", translated: "我们今天晚上一起去吃饭", sourceLang: "en", targetLang: "ja", err: "no kana"},
+		{name: "short han-only japanese", source: "Tokyo station", translated: "東京駅", sourceLang: "en", targetLang: "ja"},
+		{name: "korean", source: "Hello everyone", translated: "안녕하세요 여러분", sourceLang: "en", targetLang: "ko"},
+		{name: "english instead of korean", source: "Hello everyone", translated: "Hello everyone, welcome", sourceLang: "ja", targetLang: "ko", err: "does not look like ko"},
+		{name: "english", source: "こんにちは", translated: "Hello there", sourceLang: "ja", targetLang: "en"},
+		{name: "chinese instead of english", source: "こんにちは", translated: "你好世界", sourceLang: "ja", targetLang: "en", err: "does not look like en"},
+		{name: "echoed source", source: "Good morning, everyone!", translated: "good morning everyone", sourceLang: "en", targetLang: "sv", err: "identical"},
+		{name: "echo under six letters", source: "Okay", translated: "Okay", sourceLang: "en", targetLang: "sv"},
+		{name: "echo of han-only text", source: "今日天気", translated: "今日天気", sourceLang: "ja", targetLang: "zh"},
+		{name: "echo into the same language", source: "Good morning everyone", translated: "Good morning everyone", sourceLang: "en-US", targetLang: "en-GB"},
+		{name: "short translation", source: "Hmm?", translated: "嗯", sourceLang: "en", targetLang: "en"},
+		{name: "short source", source: "A", translated: "Hello there", sourceLang: "en", targetLang: "zh"},
+		{name: "language without script", source: "Hello there", translated: "你好", sourceLang: "en", targetLang: "sv"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := Config{languageCheck: true, sourceLang: test.sourceLang, targetLang: test.targetLang}
+			err := checkLanguage(test.source, test.translated, &config)
+			if test.err == "" {
+				if err != nil {
+					t.Errorf("got error %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("got error %v, want one containing %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestCheckLanguageDisabled(t *testing.T) {
+	config := Config{sourceLang: "en", targetLang: "zh"}
+	if err := checkLanguage("Good morning everyone", "Good morning everyone", &config); err != nil {
+		t.Errorf("got error %v with the check disabled", err)
+	}
+}
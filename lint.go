@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+const minLintDuration = 300 * time.Millisecond // Cues shorter than this are flashes no one can read
+
+// lintSegments checks the segments for timing and text problems, and for the readability limits of the config.
+// Returns one line per problem.
+func lintSegments(segments []SrtSegment, config *Config) []string {
+	var problems []string
+	report := func(segment SrtSegment, format string, args ...any) {
+		problems = append(problems, fmt.Sprintf("%s (%s): %s", segment.ID, segment.Time, fmt.Sprintf(format, args...)))
+	}
+
+	ids := make(map[string]bool)
+	var previousStart, previousEnd time.Duration
+	previousText := ""
+	for i, segment := range segments {
+		if ids[segment.ID] {
+			report(segment, "duplicate ID")
+		}
+		ids[segment.ID] = true
+
+		if strings.TrimSpace(segment.Text) == "" {
+			report(segment, "empty text")
+		} else if i > 0 && normalizeForComparison(segment.Text) == normalizeForComparison(previousText) {
+			report(segment, "same text as the previous cue")
+		}
+		previousText = segment.Text
+
+		start, end, err := parseTimeRange(segment.Time)
+		if err != nil {
+			report(segment, "%v", err)
+			continue
+		}
+		switch {
+		case end <= start:
+			report(segment, "ends before it starts")
+		case end-start < minLintDuration:
+			report(segment, "shown for only %s", end-start)
+		}
+		if i > 0 && start < previousStart {
+			report(segment, "starts before the previous cue")
+		} else if i > 0 && start < previousEnd {
+			report(segment, "overlaps the previous cue by %s", previousEnd-start)
+		}
+		previousStart, previousEnd = start, end
+
+		for _, violation := range readabilityViolations(segment, config) {
+			report(segment, "%s", violation)
+		}
+	}
+	return problems
+}
+
+// printStats prints statistics about the timing and text of the segments.
+func printStats(segments []SrtSegment) {
+	fmt.Printf("Cues: %d\n", len(segments))
+	if len(segments) == 0 {
+		return
+	}
+
+	var durations []time.Duration
+	var first, last, shown time.Duration
+	var characters, lines, maxLines, overlaps, shortGaps int
+	var maxCPS float64
+	maxCPSID := ""
+	first = -1
+	var previousEnd time.Duration
+	for i, segment := range segments {
+		characters += readableLength(segment.Text)
+		segmentLines := strings.Count(segment.Text, "\n") + 1
+		lines += segmentLines
+		maxLines = max(maxLines, segmentLines)
+
+		start, end, err := parseTimeRange(segment.Time)
+		if err != nil || end <= start {
+			continue
+		}
+		if first < 0 || start < first {
+			first = start
+		}
+		last = max(last, end)
+		durations = append(durations, end-start)
+		shown += end - start
+		if cps, ok := charactersPerSecond(segment); ok && cps > maxCPS {
+			maxCPS, maxCPSID = cps, segment.ID
+		}
+		if i > 0 {
+			if start < previousEnd {
+				overlaps++
+			} else if start-previousEnd < 100*time.Millisecond {
+				shortGaps++
+			}
+		}
+		previousEnd = end
+	}
+
+	fmt.Printf("Characters: %d (%.1f per cue, spaces excluded)\n", characters, float64(characters)/float64(len(segments)))
+	fmt.Printf("Lines: %d (%.2f per cue, at most %d)\n", lines, float64(lines)/float64(len(segments)), maxLines)
+	if len(durations) == 0 {
+		return
+	}
+	slices.Sort(durations)
+	fmt.Printf("Span: %s --> %s\n", formatSrtTime(first), formatSrtTime(last))
+	fmt.Printf("Shown: %s (%.0f%% of the span)\n", shown.Round(time.Second), 100*float64(shown)/float64(max(last-first, 1)))
+	fmt.Printf("Duration per cue: shortest %s, median %s, longest %s\n",
+		durations[0], durations[len(durations)/2], durations[len(durations)-1])
+	fmt.Printf("Reading speed: %.1f characters per second on average, at most %.1f (ID %s)\n",
+		float64(characters)/shown.Seconds(), maxCPS, maxCPSID)
+	fmt.Printf("Overlapping cues: %d, gaps under 100ms: %d\n", overlaps, shortGaps)
+}
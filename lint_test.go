@@ -0,0 +1,87 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLintSegments(t *testing.T) {
+	tests := []struct {
+		name     string
+		segments []SrtSegment
+		config   Config
+		want     []string // Start of each problem
+	}{
+		{
+			name:     "clean",
+			segments: segmentsOf("00:00:01,000 --> 00:00:02,000", "Hello", "00:00:02,000 --> 00:00:03,000", "Bye"),
+		},
+		{
+			name: "duplicate ID",
+			segments: []SrtSegment{
+				{ID: "1", Time: "00:00:01,000 --> 00:00:02,000", Text: "Hello"},
+				{ID: "1", Time: "00:00:03,000 --> 00:00:04,000", Text: "Bye"},
+			},
+			want: []string{"1 (00:00:03,000 --> 00:00:04,000): duplicate ID"},
+		},
+		{
+			name:     "empty and repeated text",
+			segments: segmentsOf("00:00:01,000 --> 00:00:02,000", " ", "00:00:03,000 --> 00:00:04,000", "Hello", "00:00:05,000 --> 00:00:06,000", "hello!"),
+			want:     []string{"1 (00:00:01,000 --> 00:00:02,000): empty text", "3 (00:00:05,000 --> 00:00:06,000): same text as the previous cue"},
+		},
+		{
+			name:     "timings",
+			segments: segmentsOf("00:00:02,000 --> 00:00:01,000", "Backwards", "00:00:03,000 --> 00:00:03,100", "Flash", "00:00:03,050 --> 00:00:04,000", "Overlap", "00:00:01,000 --> 00:00:05,000", "Unsorted"),
+			want: []string{
+				"1 (00:00:02,000 --> 00:00:01,000): ends before it starts",
+				"2 (00:00:03,000 --> 00:00:03,100): shown for only 100ms",
+				"3 (00:00:03,050 --> 00:00:04,000): overlaps the previous cue by 50ms",
+				"4 (00:00:01,000 --> 00:00:05,000): starts before the previous cue",
+			},
+		},
+		{
+			name:     "unreadable time line",
+			segments: segmentsOf("bad", "Hello"),
+			want:     []string{"1 (bad): "},
+		},
+		{
+			name:     "readability",
+			segments: segmentsOf("00:00:01,000 --> 00:00:02,000", "one two three four"),
+			config:   Config{maxLineWidth: 10, maxLines: 2},
+			want:     []string{"1 (00:00:01,000 --> 00:00:02,000): line width 18"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			problems := lintSegments(test.segments, &test.config)
+			if len(problems) != len(test.want) {
+				t.Fatalf("got problems %q, want %q", problems, test.want)
+			}
+			for i, problem := range problems {
+				if !strings.HasPrefix(problem, test.want[i]) {
+					t.Errorf("got problem %q, want %q", problem, test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLintVttFile(t *testing.T) {
+	// Cue identifiers are optional and free-form, they must not be reported as duplicates
+	path := filepath.Join(t.TempDir(), "input.vtt")
+	content := "WEBVTT\n\nintro\n00:00:01.000 --> 00:00:02.000\nHello\n\n00:00:03.000 --> 00:00:04.000\nWorld\n\n" +
+		"00:00:05.000 --> 00:00:06.000\nBye\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	segments, err := readSubtitleFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if problems := lintSegments(segments, &Config{}); len(problems) != 0 {
+		t.Errorf("got problems %q", problems)
+	}
+}
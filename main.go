@@ -2,136 +2,471 @@ package main
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"text/template"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 // Config stores CLI arguments and flags.
 type Config struct {
 	sourceSrt            string
 	destSrt              string
+	outDir               string
+	outputBase           string // Path without extension the outputs of the current file are named after
+	parallelFiles        int
 	referenceSrt         string
+	referenceTranslator  string
+	referenceModel       string
 	translator           string
 	apiUrl               string
 	apiKey               string
+	apiKeyFile           string
+	configFile           string
+	profile              string
 	modelName            string
 	systemPrompt         string
 	userPrompt           string
 	userPrompt3          string
+	userPromptPivot      string
+	promptTemplateFile   string
+	promptTemplate       *template.Template // Replaces the system and user prompts when set
+	glossaryFile         string
+	glossary             []GlossaryEntry
+	examplesFile         string
+	examples             []Example
+	examplesK            int
+	title                string
+	notes                string
+	contextLines         int
 	sourceLang           string
 	targetLang           string
+	pivotLang            string
+	savePivot            bool
+	review               bool
+	reviewApiUrl         string
+	reviewApiKey         string
+	reviewModel          string
+	reviewPrompt         string
+	qaMode               string
+	qaTranslator         string
+	qaModel              string
+	qaLowest             int
+	qaThreshold          float64
+	qaRetranslateModel   string
+	candidates           int
+	candidateModels      string
+	candidateTemperature float32
+	selectMode           string
+	judgeModel           string
+	judgePrompt          string
 	temperature          float32
 	topP                 float32
 	maxTokens            int
 	maxRequestsPerMinute int
 	maxRetries           int
 	singleLine           bool
+	languageCheck        bool
 	bilingual            bool
 	preProcessing1       bool
 	preProcessing2       bool
 	preProcessing3       bool
+	preProcessing4       bool
+	preProcessing5       bool
+	preProcessing6       bool
+	hallucinationFile    string
+	removedLog           string
+	splitDuration        float64
+	splitMaxChars        int
+	mergeGap             int
+	mergeMaxChars        int
+	mergeSplit           string
 	postProcessing1      bool
+	postProcessing2      bool
+	timingShift          string
+	timingAnchors        []string
+	fpsFrom              float64
+	fpsTo                float64
+	syncMaxOffset        float64
+	outputFormat         string
+	syncWindow           float64
+	watchInterval        float64
+	watchSettle          float64
+	preSteps             string
+	preStepsSet          bool
+	postSteps            string
+	postStepsSet         bool
+	postPipeline         []ProcessingStep
+	maxLineWidth         int
+	maxLines             int
+	maxCPS               float64
+	shorten              bool
+	shortenPrompt        string
+	memoryFile           string
+	dryRun               bool
+	failurePolicy        string
+	failureMarker        string
+	reportFile           string
+	inputPrice           float64
+	outputPrice          float64
 	TranslatorImpl       Translator
+	limiter              *RateLimiter
+	referenceBackend     *Config // Backend producing the reference translation in two-pass mode
+	reviewBackend        *Config // Backend reviewing the translation
+	qaBackend            *Config // Backend back-translating the translation for the quality check
+	judgeBackend         *Config // Backend picking the best candidate translation
+	retranslateBackend   *Config // Backend re-translating the segments scoring low in the quality check
+	memory               *TranslationMemory
+	usage                *UsageCounter
 }
 
 // SrtSegment represents a subtitle segment.
 type SrtSegment struct {
-	ID   string
-	Time string
-	Text string
-	Err  error
+	ID         string
+	Time       string
+	Text       string
+	Err        error
+	Attempts   int                 // Number of translation requests that included this segment
+	Backend    string              // Translator that produced the text
+	Draft      string              // Text before the review pass, set only when the review changed it
+	Quality    *QualityCheck       // Back-translation score, set only when the quality check ran
+	Candidates *CandidateSelection // Candidate translations, set only when several candidates were generated
+	Violations []string            // Readability limits still exceeded after postprocessing
+	Parts      []SrtSegment        // Original segments merged into this sentence unit, set only by preprocessing method 4
+	SplitMode  string              // How the translation of a sentence unit is split back across Parts: "duration" or "length"
+	CueID      string              // WebVTT cue identifier, kept apart so that the ID sent for translation is a number
 }
 
 func main() {
 	var config Config
-	var result []SrtSegment
-	var reference []SrtSegment
+
+	// Translation is the default command
+	translate := func(cmd *cobra.Command, args []string) {
+		checkError(setupTranslator(&config))
+		files, err := expandInputs(args)
+		checkError(err)
+		if len(files) > 1 && config.destSrt != "" {
+			checkError(fmt.Errorf("--dest cannot be used with several input files, use --out_dir"))
+		}
+		if len(files) > 1 && config.referenceSrt != "" {
+			checkError(fmt.Errorf("--reference cannot be used with several input files, it would be aligned with every one of them"))
+		}
+
+		if config.dryRun {
+			for _, file := range files {
+				fileConfig := configForFile(&config, file)
+				segments, reference, err := loadSegments(&fileConfig)
+				checkError(err)
+				printTranslationPlan(segments, reference, &fileConfig)
+			}
+			return
+		}
+
+		setupTranslation(&config)
+
+		// Translate the files in parallel, rate limiting, the translation memory and the usage counter are shared
+		statuses := translateFiles(files, &config)
+		checkError(config.memory.save())
+		if len(files) > 1 {
+			printBatchSummary(statuses)
+		}
+		if config.translator == "openai" {
+			fmt.Printf("Usage: %s\n", config.usage.describe(&config))
+		}
+		checkError(batchError(statuses))
+	}
 
 	rootCmd := &cobra.Command{
-		Use:   "stgo <COMMAND>",
+		Use:   "stgo [COMMAND] <SRT>...",
 		Short: "Subtitle translation and processing tool written in Go",
 		Long:  "Subtitle translation and processing tool written in Go",
-		Args:  cobra.ExactArgs(1),
+		Args:  cobra.MinimumNArgs(1),
 		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			// Fill the flags not given on the command line from the environment and the configuration file
+			if config.profile == "" {
+				config.profile = os.Getenv("STGO_PROFILE")
+			}
+			if config.configFile == "" {
+				config.configFile = os.Getenv("STGO_CONFIG")
+			}
+			checkError(applySettings(cmd, config.configFile, config.profile))
+			if config.apiKey == "" && config.apiKeyFile != "" {
+				var err error
+				config.apiKey, err = readSecretFile(config.apiKeyFile)
+				checkError(err)
+			}
+
+			if config.promptTemplateFile != "" {
+				var err error
+				config.promptTemplate, err = loadPromptTemplate(config.promptTemplateFile)
+				checkError(err)
+			}
+			if config.glossaryFile != "" {
+				var err error
+				config.glossary, err = loadGlossary(config.glossaryFile)
+				checkError(err)
+			}
+			if config.examplesFile != "" {
+				var err error
+				config.examples, err = loadExamples(config.examplesFile)
+				checkError(err)
+			}
+			if config.promptTemplate != nil {
+				// Catch unknown fields before any request is sent
+				_, err := buildMessages(samplePromptRequest(), &config)
+				checkError(err)
+			}
+
+			// An empty pipeline given explicitly disables the numbered processing flags too
+			config.preStepsSet = cmd.Flags().Changed("pre")
+			config.postStepsSet = cmd.Flags().Changed("post")
+		},
+		Run: translate,
+	}
+
+	translateCmd := &cobra.Command{
+		Use:   "translate <SRT>...",
+		Short: "Translate subtitle files, folders or glob patterns, the default command",
+		Args:  cobra.MinimumNArgs(1),
+		Run:   translate,
+	}
+	rootCmd.AddCommand(translateCmd)
+
+	convertCmd := &cobra.Command{
+		Use:   "convert <SRT>",
+		Short: "Convert a subtitle file to another format, given by the extension of --dest or by --format",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
 			config.sourceSrt = args[0]
+			segments, err := readSubtitleFile(config.sourceSrt)
+			checkError(err)
+			if config.destSrt == "" {
+				if config.outputFormat == "" {
+					checkError(fmt.Errorf("--dest or --format is required"))
+				}
+				config.destSrt = strings.TrimSuffix(config.sourceSrt, filepath.Ext(config.sourceSrt)) + "." + strings.TrimPrefix(config.outputFormat, ".")
+			}
+			checkError(saveSubtitleFile(segments, segments, config.destSrt, false))
+			fmt.Printf("Saved %d segments to %s\n", len(segments), config.destSrt)
+		},
+	}
+	convertCmd.Flags().StringVar(&config.outputFormat, "format", "",
+		"The output format when --dest is not set, options: srt, vtt.")
+	rootCmd.AddCommand(convertCmd)
+
+	fixCmd := &cobra.Command{
+		Use:   "fix <SRT>",
+		Short: "Apply the preprocessing and postprocessing steps only, without translating",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			config.sourceSrt = args[0]
+			// The translator is only used if a step asks the AI, e.g. to shorten lines
+			checkError(setupTranslator(&config))
+			postSpec := config.postSteps
+			if !config.postStepsSet {
+				postSpec = legacyPipeline(postStage, &config)
+			}
+			postPipeline, err := parsePipeline(postSpec, postStage, &config)
+			checkError(err)
+
+			segments, _, err := loadSegments(&config)
+			checkError(err)
+			// Merging only matters for translation, keep the original segments
+			segments, _ = splitMergedSegments(segments, segments)
+			segments, err = runPipeline(postPipeline, segments, segments, &config)
+			checkError(err)
 
-			// Automatically set the destination file based on the source file if not provided.
 			if config.destSrt == "" {
 				ext := filepath.Ext(config.sourceSrt)
-				base := strings.TrimSuffix(config.sourceSrt, ext)
-				config.destSrt = base + "." + config.translator + ".translated" + ext
+				config.destSrt = strings.TrimSuffix(config.sourceSrt, ext) + ".fixed" + ext
 			}
+			checkError(saveSubtitleFile(segments, segments, config.destSrt, false))
+			fmt.Printf("Saved %d segments to %s\n", len(segments), config.destSrt)
+		},
+	}
+	rootCmd.AddCommand(fixCmd)
 
-			// Replace placeholders in the user prompts with the actual languages.
-			replacements := map[string]string{
-				"<source_lang>": config.sourceLang,
-				"<target_lang>": config.targetLang,
+	lintCmd := &cobra.Command{
+		Use:   "lint <SRT>",
+		Short: "Check a subtitle file for timing problems and readability limits (maxlinewidth, maxlines, maxcps)",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			config.sourceSrt = args[0]
+			segments, err := readSubtitleFile(config.sourceSrt)
+			checkError(err)
+			problems := lintSegments(segments, &config)
+			for _, problem := range problems {
+				fmt.Println(problem)
+			}
+			if len(problems) > 0 {
+				checkError(fmt.Errorf("%d problems found in %d segments", len(problems), len(segments)))
 			}
-			config.userPrompt = replacePlaceholders(config.userPrompt, replacements)
-			config.userPrompt3 = replacePlaceholders(config.userPrompt3, replacements)
+			fmt.Printf("No problems found in %d segments\n", len(segments))
 		},
+	}
+	rootCmd.AddCommand(lintCmd)
+
+	statsCmd := &cobra.Command{
+		Use:   "stats <SRT>",
+		Short: "Print statistics about the timing and text of a subtitle file",
+		Args:  cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
-			segments, err := readSrtFile(config.sourceSrt)
+			config.sourceSrt = args[0]
+			segments, err := readSubtitleFile(config.sourceSrt)
 			checkError(err)
+			printStats(segments)
+		},
+	}
+	rootCmd.AddCommand(statsCmd)
 
-			// Apply preprocessing steps if enabled
-			if config.preProcessing1 {
-				segments = reduceRepeatedPatterns(segments)
-			}
-			if config.preProcessing2 {
-				segments = deleteSrtSegmentsOnlyContainsRepeatedCharacters(segments)
+	planCmd := &cobra.Command{
+		Use:   "plan <SRT>...",
+		Short: "Show the batches, token estimates and projected cost of a translation without sending any request",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			config.dryRun = true // The pipeline steps must not write any file either
+			checkError(setupTranslator(&config))
+			files, err := expandInputs(args)
+			checkError(err)
+			if len(files) > 1 && config.referenceSrt != "" {
+				checkError(fmt.Errorf("--reference cannot be used with several input files, it would be aligned with every one of them"))
 			}
-			if config.preProcessing3 {
-				segments = extendSegments(segments)
+			for _, file := range files {
+				fileConfig := configForFile(&config, file)
+				segments, reference, err := loadSegments(&fileConfig)
+				checkError(err)
+				printTranslationPlan(segments, reference, &fileConfig)
 			}
+		},
+	}
+	rootCmd.AddCommand(planCmd)
 
-			// Load reference SRT if provided
-			if config.referenceSrt != "" {
-				reference, err = readSrtFile(config.referenceSrt)
-				checkError(err)
+	timingCmd := &cobra.Command{
+		Use:   "timing <SRT>",
+		Short: "Shift, stretch or convert the framerate of subtitle timings, without translating",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			config.sourceSrt = args[0]
+			transform, err := buildTimeTransform(&config)
+			checkError(err)
+			segments, err := readSubtitleFile(config.sourceSrt)
+			checkError(err)
+			checkError(retimeSegments(segments, transform))
+
+			if config.destSrt == "" {
+				ext := filepath.Ext(config.sourceSrt)
+				config.destSrt = strings.TrimSuffix(config.sourceSrt, ext) + ".timing" + ext
 			}
+			checkError(saveSubtitleFile(segments, segments, config.destSrt, false))
+			fmt.Printf("Saved %d segments to %s\n", len(segments), config.destSrt)
+		},
+	}
+	timingCmd.Flags().StringVar(&config.timingShift, "shift", "",
+		"Shift every subtitle by a constant offset, e.g. '-2.5s', '1500ms' or '-00:00:02,500'.")
+	timingCmd.Flags().StringArrayVar(&config.timingAnchors, "anchor", nil,
+		"Stretch the timings linearly so that a current time maps to a new time, e.g. '00:01:00,000=00:01:02,500'. Give exactly two anchors, usually one near the start and one near the end.")
+	timingCmd.Flags().Float64Var(&config.fpsFrom, "fps_from", 0,
+		"Framerate the subtitles were authored for, e.g. 23.976. (requires fps_to)")
+	timingCmd.Flags().Float64Var(&config.fpsTo, "fps_to", 0,
+		"Framerate to convert the subtitles to, e.g. 25. (requires fps_from)")
+	rootCmd.AddCommand(timingCmd)
 
-			// Configure and use the selected translator
-			switch config.translator {
-			case "google":
-				// Apply Google Translate specific limits
-				config.maxTokens = min(config.maxTokens, 5000) // Google Translate web only accepts up to 5000 characters
-				config.maxRequestsPerMinute = min(config.maxRequestsPerMinute, 3)
-				config.TranslatorImpl = new(GoogleTranslator)
-			case "openai":
-				config.TranslatorImpl = new(OpenAITranslator)
-			default:
-				checkError(fmt.Errorf("unknown translator: %s", config.translator))
-				return
+	syncCmd := &cobra.Command{
+		Use:   "sync --to <REFERENCE> <SRT>",
+		Short: "Align the timings of a subtitle with a correctly timed subtitle, e.g. in another language, without audio",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			config.sourceSrt = args[0]
+			if config.referenceSrt == "" {
+				checkError(fmt.Errorf("--to is required"))
 			}
+			segments, err := readSubtitleFile(config.sourceSrt)
+			checkError(err)
+			reference, err := readSubtitleFile(config.referenceSrt)
+			checkError(err)
 
-			// Perform the translation
-			result = translateSrtSegmentsInBatches(segments, reference, &config)
+			transform, description, err := syncTimings(segments, reference,
+				time.Duration(config.syncMaxOffset*float64(time.Second)), time.Duration(config.syncWindow*float64(time.Second)))
+			checkError(err)
+			fmt.Println(strings.Join(description, "\n"))
+			checkError(retimeSegments(segments, transform))
 
-			// Apply postprocessing if enabled
-			if config.postProcessing1 {
-				result = trimAnnotation(segments, result)
+			if config.destSrt == "" {
+				ext := filepath.Ext(config.sourceSrt)
+				config.destSrt = strings.TrimSuffix(config.sourceSrt, ext) + ".synced" + ext
 			}
+			checkError(saveSubtitleFile(segments, segments, config.destSrt, false))
+			fmt.Printf("Saved %d segments to %s\n", len(segments), config.destSrt)
+		},
+	}
+	syncCmd.Flags().StringVar(&config.referenceSrt, "to", "",
+		"The correctly timed reference subtitle file.")
+	syncCmd.Flags().Float64Var(&config.syncMaxOffset, "maxoffset", 120,
+		"The maximum offset in seconds searched between the two subtitles.")
+	syncCmd.Flags().Float64Var(&config.syncWindow, "window", 0,
+		"Also align every window of this many seconds on its own and interpolate the correction between them (piecewise-linear), 0 for a single constant shift. Around 300 corrects drift.")
+	rootCmd.AddCommand(syncCmd)
 
-			// Save the translated file
-			err = saveSrtFile(result, segments, config.destSrt, config.bilingual)
+	watchCmd := &cobra.Command{
+		Use:   "watch <DIR>",
+		Short: "Translate the subtitle files dropped into a folder, moving them with their outputs into done or failed",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			config.sourceSrt = args[0]
+			if config.destSrt != "" || config.outDir != "" {
+				checkError(fmt.Errorf("--dest and --out_dir cannot be used with watch, the outputs are moved into done or failed"))
+			}
+			if config.referenceSrt != "" {
+				checkError(fmt.Errorf("--reference cannot be used with watch, it would be aligned with every file"))
+			}
+			info, err := os.Stat(config.sourceSrt)
 			checkError(err)
+			if !info.IsDir() {
+				checkError(fmt.Errorf("%s is not a folder", config.sourceSrt))
+			}
+			checkError(setupTranslator(&config))
+			setupTranslation(&config)
+			config.outDir = filepath.Join(config.sourceSrt, watchWorkDir)
+			checkError(watchFolder(config.sourceSrt,
+				time.Duration(config.watchInterval*float64(time.Second)), time.Duration(config.watchSettle*float64(time.Second)), &config))
 		},
 	}
+	watchCmd.Flags().Float64Var(&config.watchInterval, "interval", 10,
+		"Seconds between two scans of the folder.")
+	watchCmd.Flags().Float64Var(&config.watchSettle, "settle", 30,
+		"Seconds the size and modification time of a file must stay unchanged before it is considered fully written.")
+	rootCmd.AddCommand(watchCmd)
 
 	// CLI flags.
 	rootCmd.PersistentFlags().StringVar(&config.destSrt, "dest", "",
 		"Path to the destination SRT file for writing.")
+	rootCmd.PersistentFlags().StringVar(&config.outDir, "out_dir", "",
+		"Folder the translations are written to, mirroring the folders of the inputs, with the same file names as next to the sources.")
+	rootCmd.PersistentFlags().IntVar(&config.parallelFiles, "parallel_files", 2,
+		"Number of files translated at the same time when several files, folders or glob patterns are given. They share maxrpm, the translation memory and the usage counter.")
 	rootCmd.PersistentFlags().StringVar(&config.referenceSrt, "reference", "",
 		"Path to the SRT file for reference.")
+	rootCmd.PersistentFlags().StringVar(&config.referenceTranslator, "reference_translator", "",
+		"Two-pass mode: the translation service producing a reference translation in memory before the main translator refines it with userprompt3, options: 'openai' or 'google'.")
+	rootCmd.PersistentFlags().StringVar(&config.referenceModel, "reference_model", "",
+		"Translation model used by the reference translator, defaults to the main model. (no effect unless reference_translator is set)")
 	rootCmd.PersistentFlags().StringVar(&config.translator, "translator", "google",
 		"Specifies the translation service to use, options: 'openai' or 'google'. The 'openai' value indicates compatibility with OpenAI-based APIs.")
 	rootCmd.PersistentFlags().StringVar(&config.apiUrl, "apiurl", "",
 		"The URL endpoint for the translation API. Not required for the 'google' translator option.")
 	rootCmd.PersistentFlags().StringVar(&config.apiKey, "apikey", "",
-		"The access key for the translation API. Not required for the 'google' translator option.")
+		"The access key for the translation API. Not required for the 'google' translator option. Prefer the STGO_APIKEY environment variable or apikey_file, which do not leak into the shell history.")
+	rootCmd.PersistentFlags().StringVar(&config.apiKeyFile, "apikey_file", "",
+		"File containing the access key for the translation API, used when apikey is not set.")
+	rootCmd.PersistentFlags().StringVar(&config.configFile, "config", "",
+		"YAML configuration file whose settings, named after the flags, apply when a flag is not given. Defaults to stgo.yaml in the working directory or in the stgo folder of the user config directory. Precedence: flags > STGO_<FLAG> environment variables > profile > top-level settings > defaults.")
+	rootCmd.PersistentFlags().StringVar(&config.profile, "profile", "",
+		"Named profile of the configuration file to apply, e.g. 'anime-ja-zh'.")
 	rootCmd.PersistentFlags().StringVar(&config.modelName, "model", "",
 		"Translation model to be used, required only for 'openai' translator.")
 	rootCmd.PersistentFlags().StringVar(&config.systemPrompt, "systemprompt",
@@ -139,14 +474,71 @@ func main() {
 		"System prompt provided to the AI.")
 	rootCmd.PersistentFlags().StringVar(&config.userPrompt, "userprompt",
 		"Instruction: Translate this text from <source_lang> to <target_lang>:\n\n<ot>",
-		"User prompt provided to the AI, Use '<ot>' as the placeholder in the template to represent the original text to be translated, and '<rt>' to represent the reference translation if any.")
+		"User prompt provided to the AI, Use '<ot>' as the placeholder in the template to represent the original text to be translated, and '<rt>' to represent the reference translation if any. '<source_lang>', '<target_lang>', '<pivot_lang>', '<source_lang_name>', '<target_lang_name>', '<glossary>', '<title>' and '<notes>' are also replaced.")
 	rootCmd.PersistentFlags().StringVar(&config.userPrompt3, "userprompt3",
 		"What needs to be translated is the following text:\n\n<ot>\nOther people translate it as:<rt>\nPlease actively refer to other people's translations to translate the above text from <source_lang> to <target_lang>:\n\n",
 		"User prompt provided to the AI, Use '<ot>' as the placeholder in the template to represent the original text to be translated, and '<rt>' to represent the reference translation if any. (no effect unless reference is set)")
+	rootCmd.PersistentFlags().StringVar(&config.userPromptPivot, "userprompt_pivot",
+		"Instruction: Translate this text from <pivot_lang> to <target_lang>:\n\n<ot>\n\nIt was translated from the following <source_lang> text, refer to it for names, tone and nuance:\n\n<rt>",
+		"User prompt provided to the AI when translating through a pivot language, Use '<ot>' as the placeholder in the template to represent the text in the pivot language, and '<rt>' to represent the original text. (no effect unless pivot is set)")
+	rootCmd.PersistentFlags().StringVar(&config.promptTemplateFile, "prompt_template", "",
+		"Go text/template file building the messages sent to the AI, replacing systemprompt and the userprompt flags. It can use .Text, .Reference, .Segments, .References, .Context.Before, .Context.After, .Glossary, .Title, .Notes, .SystemPrompt, the language codes .SourceLang, .TargetLang, .PivotLang and their names .SourceLangName, .TargetLangName, .PivotLangName, and the functions srt, text, langName and join. Lines such as '--- system ---', '--- user ---' or '--- assistant ---' start a new message; without them the output is one user message after the system prompt.")
+	rootCmd.PersistentFlags().StringVar(&config.glossaryFile, "glossary", "",
+		"Glossary file with one 'term<TAB>translation' or 'term = translation' entry per line. The entries found in a batch are given to the prompt as <glossary> or .Glossary.")
+	rootCmd.PersistentFlags().StringVar(&config.title, "title", "",
+		"Title of the show, given to the prompt as <title> or .Title. Defaults to the file name without extension.")
+	rootCmd.PersistentFlags().StringVar(&config.notes, "notes", "",
+		"Notes about the show, such as the characters and their relations, given to the prompt as <notes> or .Notes.")
+	rootCmd.PersistentFlags().StringVar(&config.examplesFile, "examples", "",
+		"YAML file of example translations, a list of entries with 'source' and 'translation', sent to the AI as previous user and assistant turns ahead of each request. Prompt templates writing their own messages lay them out with .Examples. Not used when translating through a pivot language.")
+	rootCmd.PersistentFlags().IntVar(&config.examplesK, "examples_k", 0,
+		"Number of examples sent with each request, the ones most similar to the batch by character bigrams. 0 sends them all. (no effect unless examples is set)")
+	rootCmd.PersistentFlags().IntVar(&config.contextLines, "context_lines", 3,
+		"Number of source segments before and after a batch given to the prompt template as .Context.Before and .Context.After, which are not translated.")
+	rootCmd.PersistentFlags().BoolVar(&config.review, "review", false,
+		"Enables a review pass: the source and the draft translation are sent back to an OpenAI compatible API with the review prompt, and the lines it corrects are replaced.")
+	rootCmd.PersistentFlags().StringVar(&config.reviewApiUrl, "review_apiurl", "",
+		"The URL endpoint for the review API, defaults to apiurl. (no effect unless review is set)")
+	rootCmd.PersistentFlags().StringVar(&config.reviewApiKey, "review_apikey", "",
+		"The access key for the review API, defaults to apikey. (no effect unless review is set)")
+	rootCmd.PersistentFlags().StringVar(&config.reviewModel, "review_model", "",
+		"Model used for the review, defaults to model. (no effect unless review is set)")
+	rootCmd.PersistentFlags().StringVar(&config.reviewPrompt, "reviewprompt",
+		"The following is a <source_lang> subtitle:\n\n<ot>\n\nThis is a draft of its translation into <target_lang>:\n\n<rt>\n\nReview the draft and correct mistranslations, omissions and awkward phrasing. Return every block of the translation with its original number and timecode, unchanged blocks included, and nothing else.",
+		"Prompt used for the review pass, Use '<ot>' as the placeholder in the template to represent the original text, and '<rt>' to represent the draft translation. (no effect unless review is set)")
+	rootCmd.PersistentFlags().StringVar(&config.qaMode, "qa", "",
+		"Quality check of the translation, options: 'backtranslate' (translate the result back into the source language and score its similarity with the original).")
+	rootCmd.PersistentFlags().StringVar(&config.qaTranslator, "qa_translator", "google",
+		"The translation service used for the back-translation, options: 'openai' or 'google'. (no effect unless qa is set)")
+	rootCmd.PersistentFlags().StringVar(&config.qaModel, "qa_model", "",
+		"Translation model used for the back-translation, defaults to model. (no effect unless qa is set)")
+	rootCmd.PersistentFlags().IntVar(&config.qaLowest, "qa_lowest", 20,
+		"The number of lowest-scoring segments listed after the quality check. (no effect unless qa is set)")
+	rootCmd.PersistentFlags().Float64Var(&config.qaThreshold, "qa_threshold", 0.2,
+		"Segments scoring below this similarity (0 to 1) are re-translated with qa_retranslate_model. (no effect unless qa_retranslate_model is set)")
+	rootCmd.PersistentFlags().StringVar(&config.qaRetranslateModel, "qa_retranslate_model", "",
+		"Re-translate the segments scoring below qa_threshold with this model, keeping the new translation if it scores better. Requires the 'openai' translator. (no effect unless qa is set)")
+	rootCmd.PersistentFlags().IntVar(&config.candidates, "candidates", 1,
+		"The number of candidate translations generated for each batch, one is picked per segment. Requires the 'openai' translator.")
+	rootCmd.PersistentFlags().StringVar(&config.candidateModels, "candidate_models", "",
+		"Comma-separated models generating the candidates in turn, defaults to model. At least as many candidates as models are generated.")
+	rootCmd.PersistentFlags().Float32Var(&config.candidateTemperature, "candidate_temperature", 0.7,
+		"Temperature of the candidates when a model generates more than one candidate.")
+	rootCmd.PersistentFlags().StringVar(&config.selectMode, "select", "agreement",
+		"How to pick a candidate for each segment, options: 'agreement' (the candidate most similar to the others) or 'judge' (ask judge_model).")
+	rootCmd.PersistentFlags().StringVar(&config.judgeModel, "judge_model", "",
+		"Model picking the best candidate when select is 'judge'.")
+	rootCmd.PersistentFlags().StringVar(&config.judgePrompt, "judgeprompt",
+		"Each numbered subtitle below contains a <source_lang> line followed by candidate translations into <target_lang>, numbered [1], [2] and so on. Choose the most accurate and natural candidate for each subtitle. Return every subtitle with its original number and timecode, and only the number of the chosen candidate as its text:\n\n<ot>",
+		"Prompt provided to the judge model, Use '<ot>' as the placeholder in the template to represent the subtitles with their candidates.")
 	rootCmd.PersistentFlags().StringVar(&config.sourceLang, "source_lang", "ja",
 		"Source language for translation.")
 	rootCmd.PersistentFlags().StringVar(&config.targetLang, "target_lang", "zh-CN",
-		"Target language for translation.")
+		"Target language for translation. Separate multiple languages with commas, e.g. 'zh-CN,zh-TW,ko,en', to translate into each of them.")
+	rootCmd.PersistentFlags().StringVar(&config.pivotLang, "pivot", "",
+		"Translate through an intermediate language, e.g. 'en': the source is translated into the pivot language first, then the pivot text is translated into the target language with the original text available to the AI.")
+	rootCmd.PersistentFlags().BoolVar(&config.savePivot, "savepivot", false,
+		"Save the translation into the pivot language as a byproduct. (no effect unless pivot is set)")
 	rootCmd.PersistentFlags().Float32Var(&config.temperature, "temperature", 0.05,
 		"Temperature setting for the AI.")
 	rootCmd.PersistentFlags().Float32Var(&config.topP, "topp", 0.95,
@@ -159,17 +551,439 @@ func main() {
 		"The maximum number of retries for translation errors.")
 	rootCmd.PersistentFlags().BoolVar(&config.singleLine, "singleline", true,
 		"When a translation error occurs, use single line mode to retry line by line.")
+	rootCmd.PersistentFlags().BoolVar(&config.languageCheck, "langcheck", true,
+		"Check that every translated line is written in the target language and is not an echo of the source text, failed lines are retried in single line mode.")
 	rootCmd.PersistentFlags().BoolVar(&config.bilingual, "bilingual", false,
 		"Enables saving both the original and translated subtitles in the destination SRT file.")
+	rootCmd.PersistentFlags().StringVar(&config.preSteps, "pre", "",
+		"Comma-separated preprocessing steps run in order, each optionally followed by options such as 'merge:gap=300:chars=60'. Available: "+stepNames(preStage)+". Replaces the numbered preprocessing flags, whose options serve as defaults.")
+	rootCmd.PersistentFlags().StringVar(&config.postSteps, "post", "",
+		"Comma-separated postprocessing steps run in order, each optionally followed by options such as 'wrap:width=32:cps=9'. Available: "+stepNames(postStage)+". Replaces the numbered postprocessing flags, whose options serve as defaults.")
 	rootCmd.PersistentFlags().BoolVar(&config.preProcessing1, "pre1", false,
 		"Preprocessing method 1: Reduces repeated patterns of 2 to 6 characters in subtitles down to two instances.")
 	rootCmd.PersistentFlags().BoolVar(&config.preProcessing2, "pre2", false,
 		"Preprocessing method 2: Removes subtitles that consist only of repeated Unicode characters.")
 	rootCmd.PersistentFlags().BoolVar(&config.preProcessing3, "pre3", true,
 		"Preprocessing method 3: If the duration of a subtitle line is less than 1.2 seconds, extend it to 1.2 seconds or longer, without exceeding the start time of the next subtitle line.")
+	rootCmd.PersistentFlags().BoolVar(&config.preProcessing4, "pre4", false,
+		"Preprocessing method 4: Merges adjacent subtitle lines into sentences before translation, unless a line ends with sentence-final punctuation, the gap is longer than mergegap or the sentence would be longer than mergemaxchars. The translation is split back across the original lines.")
+	rootCmd.PersistentFlags().BoolVar(&config.preProcessing5, "pre5", false,
+		"Preprocessing method 5: Splits subtitle lines longer than splitduration or splitmaxchars into several lines, preferably after punctuation, with times taken from word timestamps such as <00:00:01.500> or interpolated by character. Runs before method 3, subtitle lines are renumbered.")
+	rootCmd.PersistentFlags().BoolVar(&config.preProcessing6, "pre6", false,
+		"Preprocessing method 6: Removes likely Whisper hallucinations: known phrases such as 'ご視聴ありがとうございました' or 'Thanks for watching', identical lines repeated across more than two consecutive subtitles, and text implausibly long or short for the duration. Runs after method 2, subtitle lines are renumbered.")
+	rootCmd.PersistentFlags().IntVar(&config.mergeGap, "mergegap", 500,
+		"The maximum gap in milliseconds between two merged subtitle lines. (no effect unless pre4 is set)")
+	rootCmd.PersistentFlags().IntVar(&config.mergeMaxChars, "mergemaxchars", 80,
+		"The maximum number of characters of a merged sentence. (no effect unless pre4 is set)")
+	rootCmd.PersistentFlags().StringVar(&config.mergeSplit, "mergesplit", "duration",
+		"How the translation of a merged sentence is split back across its lines, options: 'duration' or 'length' (of the source text). (no effect unless pre4 is set)")
+	rootCmd.PersistentFlags().Float64Var(&config.splitDuration, "splitduration", 7,
+		"The maximum duration in seconds of a subtitle line, 0 for no limit. (no effect unless pre5 is set)")
+	rootCmd.PersistentFlags().IntVar(&config.splitMaxChars, "splitmaxchars", 40,
+		"The maximum number of characters of a subtitle line, 0 for no limit. (no effect unless pre5 is set)")
+	rootCmd.PersistentFlags().StringVar(&config.hallucinationFile, "hallucinations", "",
+		"File of additional hallucination phrases, one per line. Phrases after a line such as '[ja]' only apply to that source language. (no effect unless pre6 is set)")
+	rootCmd.PersistentFlags().StringVar(&config.removedLog, "removedlog", "",
+		"File listing the subtitles removed as hallucinations and why, defaults to the source file name with the extension replaced by '.removed.log'. (no effect unless pre6 is set)")
 	rootCmd.PersistentFlags().BoolVar(&config.postProcessing1, "post1", true,
 		"Postprocessing method 1: Discard line breaks and subsequent content if the translation has more line breaks than the original text.")
+	rootCmd.PersistentFlags().StringVar(&config.failurePolicy, "onerror", "keep",
+		"How to write segments that failed to translate, options: 'keep' (keep the original text), 'marker' (prefix the original text with the error marker) or 'empty' (leave the text empty).")
+	rootCmd.PersistentFlags().StringVar(&config.failureMarker, "errormarker", "[STGERROR]",
+		"The marker written in front of failed segments when --onerror=marker.")
+	rootCmd.PersistentFlags().StringVar(&config.reportFile, "report", "",
+		"Path to a report file listing the status, attempts, backend and error of each segment, in JSON or CSV format depending on the file extension.")
+	rootCmd.PersistentFlags().StringVar(&config.memoryFile, "tm", "",
+		"Path to a JSON translation memory file. Segments already translated with the same translator and languages are taken from it, and new translations are added to it.")
+	rootCmd.PersistentFlags().BoolVar(&config.postProcessing2, "post2", false,
+		"Postprocessing method 2: Re-wrap translated lines wider than maxlinewidth, preferably at punctuation, and check maxlines and maxcps. Segments still exceeding the limits are listed in the report.")
+	rootCmd.PersistentFlags().IntVar(&config.maxLineWidth, "maxlinewidth", 42,
+		"The maximum width of a subtitle line, full-width CJK characters count as two. (no effect unless post2 is set)")
+	rootCmd.PersistentFlags().IntVar(&config.maxLines, "maxlines", 2,
+		"The maximum number of lines of a subtitle. (no effect unless post2 is set)")
+	rootCmd.PersistentFlags().Float64Var(&config.maxCPS, "maxcps", 0,
+		"The maximum reading speed in characters per second, spaces excluded, 0 for no limit. (no effect unless post2 is set)")
+	rootCmd.PersistentFlags().BoolVar(&config.shorten, "shorten", false,
+		"Ask the AI to shorten the segments exceeding the readability limits. Requires the 'openai' translator. (no effect unless post2 is set)")
+	rootCmd.PersistentFlags().StringVar(&config.shortenPrompt, "shortenprompt",
+		"The following <target_lang> subtitles are too long to be read on screen. Each one starts with its maximum number of characters in brackets. Shorten every subtitle to fit, keeping its meaning and tone. Return every subtitle with its original number and timecode, and only the shortened text without the brackets:\n\n<ot>",
+		"Prompt used to shorten subtitles, Use '<ot>' as the placeholder in the template to represent the subtitles. (no effect unless shorten is set)")
+	rootCmd.PersistentFlags().BoolVar(&config.dryRun, "dry-run", false,
+		"Print the translation plan (batches, token estimates, projected time and cost) without sending any request.")
+	rootCmd.PersistentFlags().Float64Var(&config.inputPrice, "inputprice", 0,
+		"Price per million input tokens, used to project the cost of a translation.")
+	rootCmd.PersistentFlags().Float64Var(&config.outputPrice, "outputprice", 0,
+		"Price per million output tokens, used to project the cost of a translation.")
+	rootCmd.SetGlobalNormalizationFunc(normalizeFlagName)
 
 	err := rootCmd.Execute()
 	checkError(err)
 }
+
+// setupTranslation validates the translation options and prepares the backends, the postprocessing pipeline,
+// the translation memory and the usage counter shared by all files.
+func setupTranslation(config *Config) {
+	// Validate the options before spending time on the translation
+	checkError(applyFailurePolicy(nil, config.failurePolicy, config.failureMarker))
+	if config.pivotLang != "" && (config.referenceSrt != "" || config.referenceTranslator != "") {
+		checkError(fmt.Errorf("--pivot cannot be combined with --reference or --reference_translator"))
+	}
+	if config.referenceSrt != "" && config.referenceTranslator != "" {
+		checkError(fmt.Errorf("--reference cannot be combined with --reference_translator"))
+	}
+	if len(splitList(config.targetLang)) == 0 {
+		checkError(fmt.Errorf("no target language"))
+	}
+	// The usage counter is shared by all backends, set it before they copy the config
+	config.usage = new(UsageCounter)
+	if config.referenceTranslator != "" {
+		config.referenceBackend = setupReferenceBackend(config)
+	}
+	if config.review {
+		config.reviewBackend = setupReviewBackend(config)
+	}
+	postSpec := config.postSteps
+	if !config.postStepsSet {
+		postSpec = legacyPipeline(postStage, config)
+	}
+	var err error
+	config.postPipeline, err = parsePipeline(postSpec, postStage, config)
+	checkError(err)
+	if candidateCount(config) > 1 {
+		if config.translator != "openai" {
+			checkError(fmt.Errorf("multiple candidates require the 'openai' translator"))
+		}
+		switch config.selectMode {
+		case "agreement":
+		case "judge":
+			config.judgeBackend = setupJudgeBackend(config)
+		default:
+			checkError(fmt.Errorf("unknown candidate selection: %s", config.selectMode))
+		}
+	}
+	if config.qaLowest < 0 {
+		checkError(fmt.Errorf("--qa_lowest must not be negative"))
+	}
+	switch config.qaMode {
+	case "":
+	case "backtranslate":
+		config.qaBackend = setupQualityBackend(config)
+		if config.qaRetranslateModel != "" {
+			config.retranslateBackend = setupRetranslateBackend(config)
+		}
+	default:
+		checkError(fmt.Errorf("unknown quality check: %s", config.qaMode))
+	}
+
+	config.memory, err = loadTranslationMemory(config.memoryFile)
+	checkError(err)
+}
+
+// loadSegments reads the source SRT file, applies the enabled preprocessing steps
+// and loads the reference SRT file if one is provided.
+func loadSegments(config *Config) ([]SrtSegment, []SrtSegment, error) {
+	segments, err := readSubtitleFile(config.sourceSrt)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Apply the preprocessing pipeline, or the enabled numbered preprocessing steps
+	spec := config.preSteps
+	if !config.preStepsSet {
+		spec = legacyPipeline(preStage, config)
+	}
+	steps, err := parsePipeline(spec, preStage, config)
+	if err != nil {
+		return nil, nil, err
+	}
+	if segments, err = runPipeline(steps, segments, nil, config); err != nil {
+		return nil, nil, err
+	}
+
+	// Load reference SRT if provided, aligned to the preprocessed segments
+	var reference []SrtSegment
+	if config.referenceSrt != "" {
+		if reference, err = readSubtitleFile(config.referenceSrt); err != nil {
+			return nil, nil, err
+		}
+		reference = alignReference(segments, reference)
+	}
+
+	return segments, reference, nil
+}
+
+// flagAliases are former names of flags, still accepted on the command line but not listed in the help.
+var flagAliases = map[string]string{
+	"dryrun": "dry-run",
+}
+
+// normalizeFlagName replaces the former name of a flag with its current name.
+func normalizeFlagName(flags *pflag.FlagSet, name string) pflag.NormalizedName {
+	if current, ok := flagAliases[name]; ok {
+		name = current
+	}
+	return pflag.NormalizedName(name)
+}
+
+// configsForTargetLanguages returns a copy of the config for each target language, with its own destination
+// and report files. With more than one language, the language is added to the file names. A language listed
+// twice, in any case, is translated once, as both would write the same files.
+func configsForTargetLanguages(config *Config) []Config {
+	var languages []string
+	for _, lang := range splitList(config.targetLang) {
+		if !slices.ContainsFunc(languages, func(other string) bool { return strings.EqualFold(other, lang) }) {
+			languages = append(languages, lang)
+		}
+	}
+
+	configs := make([]Config, 0, len(languages))
+	for _, lang := range languages {
+		languageConfig := *config
+		languageConfig.targetLang = lang
+
+		suffix := ""
+		if len(languages) > 1 {
+			suffix = "." + lang
+		}
+
+		// Automatically set the destination file based on the source file if not provided.
+		if config.destSrt == "" {
+			ext := filepath.Ext(config.sourceSrt)
+			languageConfig.destSrt = config.outputBase + "." + config.translator + suffix + ".translated" + ext
+		} else {
+			languageConfig.destSrt = insertSuffix(config.destSrt, suffix)
+		}
+		if config.reportFile != "" {
+			languageConfig.reportFile = insertSuffix(config.reportFile, suffix)
+		}
+
+		configs = append(configs, languageConfig)
+	}
+	return configs
+}
+
+// insertSuffix inserts the suffix between the base name and the extension of a file path.
+func insertSuffix(path string, suffix string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + suffix + ext
+}
+
+// translatePivot translates the segments into the pivot language and optionally saves the pivot file.
+func translatePivot(segments []SrtSegment, config *Config) ([]SrtSegment, error) {
+	pivotConfig := *config
+	pivotConfig.targetLang = config.pivotLang
+	pivotConfig.pivotLang = ""
+	pivotConfig.examples = nil // The examples are translated into the target language, not the pivot language
+
+	fmt.Printf("Translating into the pivot language %s\n", pivotConfig.targetLang)
+	pivot := translateSrtSegmentsInBatches(segments, nil, &pivotConfig)
+	if pivot == nil {
+		return nil, fmt.Errorf("translation into the pivot language %s aborted", pivotConfig.targetLang)
+	}
+	if failed := countFailedSegments(pivot); failed > 0 {
+		fmt.Printf("%d segments failed to translate into the pivot language and are translated from %s directly\n",
+			failed, config.sourceLang)
+	}
+
+	if config.savePivot {
+		ext := filepath.Ext(config.sourceSrt)
+		segments, pivot := splitMergedSegments(segments, pivot)
+		pivotFile := config.outputBase + "." + config.translator + "." + config.pivotLang + ".pivot" + ext
+		if err := saveSubtitleFile(pivot, segments, pivotFile, config.bilingual); err != nil {
+			return nil, err
+		}
+	}
+	return pivot, nil
+}
+
+// setupReferenceBackend prepares the backend producing the reference translation in two-pass mode.
+// It has its own rate limiter, shared by all target languages.
+func setupReferenceBackend(config *Config) *Config {
+	referenceConfig := *config
+	referenceConfig.translator = config.referenceTranslator
+	referenceConfig.referenceTranslator = ""
+	if config.referenceModel != "" {
+		referenceConfig.modelName = config.referenceModel
+	}
+	checkError(setupTranslator(&referenceConfig))
+	return &referenceConfig
+}
+
+// translateReference produces the reference translation of the segments with the reference backend.
+// Segments that failed to translate are left without reference.
+func translateReference(segments []SrtSegment, config *Config) ([]SrtSegment, error) {
+	referenceConfig := *config.referenceBackend
+	referenceConfig.targetLang = config.targetLang
+
+	fmt.Printf("Translating the reference into %s with %s\n", referenceConfig.targetLang, backendName(&referenceConfig))
+	reference := translateSrtSegmentsInBatches(segments, nil, &referenceConfig)
+	if reference == nil {
+		return nil, fmt.Errorf("reference translation into %s aborted", referenceConfig.targetLang)
+	}
+	for i := range reference {
+		if reference[i].Err != nil {
+			reference[i].Text = ""
+		}
+	}
+	return reference, nil // Already aligned one to one with the segments
+}
+
+// setupReviewBackend prepares the OpenAI compatible backend of the review pass, with its own rate limiter.
+// The review prompt is used as the reference prompt, the draft being the reference.
+func setupReviewBackend(config *Config) *Config {
+	reviewConfig := *config
+	reviewConfig.translator = "openai"
+	reviewConfig.referenceBackend = nil
+	reviewConfig.pivotLang = ""
+	reviewConfig.memory = nil // Reviews are not stored in the translation memory
+	reviewConfig.userPrompt3 = config.reviewPrompt
+	reviewConfig.promptTemplate = nil
+	reviewConfig.examples = nil
+	if config.reviewApiUrl != "" {
+		reviewConfig.apiUrl = config.reviewApiUrl
+	}
+	if config.reviewApiKey != "" {
+		reviewConfig.apiKey = config.reviewApiKey
+	}
+	if config.reviewModel != "" {
+		reviewConfig.modelName = config.reviewModel
+	}
+	if reviewConfig.apiUrl == "" || reviewConfig.modelName == "" {
+		checkError(fmt.Errorf("the review pass requires an API URL and a model, set --review_apiurl and --review_model"))
+	}
+	checkError(setupTranslator(&reviewConfig))
+	return &reviewConfig
+}
+
+// setupQualityBackend prepares the backend of the back-translation quality check, with its own rate limiter.
+func setupQualityBackend(config *Config) *Config {
+	if config.qaRetranslateModel != "" && config.translator != "openai" {
+		checkError(fmt.Errorf("--qa_retranslate_model requires the 'openai' translator"))
+	}
+
+	qaConfig := *config
+	qaConfig.translator = config.qaTranslator
+	qaConfig.referenceBackend = nil
+	qaConfig.reviewBackend = nil
+	qaConfig.pivotLang = ""
+	qaConfig.promptTemplate = nil
+	qaConfig.examples = nil
+	if config.qaModel != "" {
+		qaConfig.modelName = config.qaModel
+	}
+	checkError(setupTranslator(&qaConfig))
+	return &qaConfig
+}
+
+// setupRetranslateBackend prepares the model re-translating the segments scoring low in the quality check,
+// with its own rate limiter shared by all files and target languages.
+func setupRetranslateBackend(config *Config) *Config {
+	retranslateConfig := *config
+	retranslateConfig.modelName = config.qaRetranslateModel
+	retranslateConfig.referenceBackend = nil
+	retranslateConfig.reviewBackend = nil
+	retranslateConfig.qaBackend = nil
+	retranslateConfig.pivotLang = ""
+	checkError(setupTranslator(&retranslateConfig))
+	return &retranslateConfig
+}
+
+// setupJudgeBackend prepares the model picking the best candidate translation, with its own rate limiter.
+// The judge prompt is used as the user prompt, and the answers are numbers rather than translations.
+func setupJudgeBackend(config *Config) *Config {
+	if config.judgeModel == "" {
+		checkError(fmt.Errorf("--select=judge requires --judge_model"))
+	}
+	judgeConfig := *config
+	judgeConfig.modelName = config.judgeModel
+	judgeConfig.userPrompt = config.judgePrompt
+	judgeConfig.promptTemplate = nil
+	judgeConfig.examples = nil
+	judgeConfig.languageCheck = false
+	judgeConfig.memory = nil
+	judgeConfig.referenceBackend = nil
+	judgeConfig.pivotLang = ""
+	checkError(setupTranslator(&judgeConfig))
+	return &judgeConfig
+}
+
+// translateToFile translates the segments with the given config, applies postprocessing and saves the
+// result and the report. If a pivot translation is given, the pivot text is translated with the original
+// text as reference. Returns the number of segments that failed to translate.
+func translateToFile(segments []SrtSegment, reference []SrtSegment, pivot []SrtSegment, config *Config) (int, error) {
+	// Perform the translation, generating several candidates if configured
+	translate := translateSrtSegmentsInBatches
+	if candidateCount(config) > 1 {
+		translate = translateCandidates
+	}
+	var result []SrtSegment
+	switch {
+	case pivot == nil:
+		if config.referenceBackend != nil {
+			var err error
+			if reference, err = translateReference(segments, config); err != nil {
+				return 0, err
+			}
+		}
+		result = translate(segments, reference, config)
+	case config.targetLang == config.pivotLang:
+		result = make([]SrtSegment, len(pivot))
+		copy(result, pivot)
+	default:
+		result = translate(pivot, segments, config)
+	}
+	if result == nil {
+		return 0, fmt.Errorf("translation into %s aborted", config.targetLang)
+	}
+
+	// Let the review backend correct the draft
+	if config.reviewBackend != nil {
+		result = reviewTranslation(segments, result, config)
+	}
+
+	// Score the translation by back-translating it
+	if config.qaBackend != nil {
+		result = checkQuality(segments, result, config)
+	}
+
+	// Distribute the translation of merged sentence units back across the original segments
+	segments, result = splitMergedSegments(segments, result)
+
+	// Apply the postprocessing pipeline
+	result, err := runPipeline(config.postPipeline, result, segments, config)
+	if err != nil {
+		return 0, err
+	}
+
+	// Save the translated file, with failed segments handled according to the policy
+	if err := applyFailurePolicy(result, config.failurePolicy, config.failureMarker); err != nil {
+		return 0, err
+	}
+	if err := saveSubtitleFile(result, segments, config.destSrt, config.bilingual); err != nil {
+		return 0, err
+	}
+
+	if config.reportFile != "" {
+		if err := writeReport(config.reportFile, segments, result, config); err != nil {
+			return 0, err
+		}
+	}
+	return countFailedSegments(result), nil
+}
+
+// setupTranslator selects the translator implementation and applies its limits to the config.
+func setupTranslator(config *Config) error {
+	switch config.translator {
+	case "google":
+		// Apply Google Translate specific limits
+		config.maxTokens = min(config.maxTokens, 5000) // Google Translate web only accepts up to 5000 characters
+		config.maxRequestsPerMinute = min(config.maxRequestsPerMinute, 3)
+		config.TranslatorImpl = new(GoogleTranslator)
+	case "openai":
+		config.TranslatorImpl = new(OpenAITranslator)
+	default:
+		return fmt.Errorf("unknown translator: %s", config.translator)
+	}
+	config.limiter = newRateLimiter(config.maxRequestsPerMinute)
+	return nil
+}
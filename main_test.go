@@ -0,0 +1,106 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+func TestConfigsForTargetLanguages(t *testing.T) {
+	tests := []struct {
+		name        string
+		targetLang  string
+		destSrt     string
+		reportFile  string
+		wantLangs   []string
+		wantDests   []string
+		wantReports []string
+	}{
+		{
+			name:        "single language",
+			targetLang:  "zh",
+			reportFile:  "report.json",
+			wantLangs:   []string{"zh"},
+			wantDests:   []string{"show.openai.translated.srt"},
+			wantReports: []string{"report.json"},
+		},
+		{
+			name:        "several languages",
+			targetLang:  "zh, ja,en",
+			reportFile:  "report.json",
+			wantLangs:   []string{"zh", "ja", "en"},
+			wantDests:   []string{"show.openai.zh.translated.srt", "show.openai.ja.translated.srt", "show.openai.en.translated.srt"},
+			wantReports: []string{"report.zh.json", "report.ja.json", "report.en.json"},
+		},
+		{
+			name:        "destination given",
+			targetLang:  "zh,ja",
+			destSrt:     "out/result.srt",
+			wantLangs:   []string{"zh", "ja"},
+			wantDests:   []string{"out/result.zh.srt", "out/result.ja.srt"},
+			wantReports: []string{"", ""},
+		},
+		{
+			name:        "duplicate languages",
+			targetLang:  "zh,ja,zh,JA",
+			wantLangs:   []string{"zh", "ja"},
+			wantDests:   []string{"show.openai.zh.translated.srt", "show.openai.ja.translated.srt"},
+			wantReports: []string{"", ""},
+		},
+		{
+			name:        "duplicates of a single language",
+			targetLang:  "zh-TW,zh-tw",
+			wantLangs:   []string{"zh-TW"},
+			wantDests:   []string{"show.openai.translated.srt"},
+			wantReports: []string{""},
+		},
+		{
+			name:       "no language",
+			targetLang: " , ",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := Config{
+				sourceSrt:  "show.srt",
+				outputBase: "show",
+				translator: "openai",
+				targetLang: test.targetLang,
+				destSrt:    test.destSrt,
+				reportFile: test.reportFile,
+			}
+			var langs, dests, reports []string
+			for _, languageConfig := range configsForTargetLanguages(&config) {
+				langs = append(langs, languageConfig.targetLang)
+				dests = append(dests, languageConfig.destSrt)
+				reports = append(reports, languageConfig.reportFile)
+			}
+			if !slices.Equal(langs, test.wantLangs) {
+				t.Errorf("got languages %q, want %q", langs, test.wantLangs)
+			}
+			if !slices.Equal(dests, test.wantDests) {
+				t.Errorf("got destinations %q, want %q", dests, test.wantDests)
+			}
+			if !slices.Equal(reports, test.wantReports) {
+				t.Errorf("got reports %q, want %q", reports, test.wantReports)
+			}
+		})
+	}
+}
+
+func TestFlagAliases(t *testing.T) {
+	for _, args := range [][]string{{"--dry-run"}, {"--dryrun"}} {
+		var dryRun bool
+		flags := pflag.NewFlagSet("stgo", pflag.ContinueOnError)
+		flags.BoolVar(&dryRun, "dry-run", false, "")
+		flags.SetNormalizeFunc(normalizeFlagName)
+		if err := flags.Parse(args); err != nil {
+			t.Fatalf("%v: %v", args, err)
+		}
+		if !dryRun {
+			t.Errorf("%v: flag not set", args)
+		}
+	}
+}
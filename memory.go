@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// TranslationMemory stores translations of segment texts, so that text already translated with the same
+// backend and language pair is not sent again. It is shared by every translation pass of a run and can be
+// persisted to a JSON file. A nil memory is valid and never finds anything.
+type TranslationMemory struct {
+	mu      sync.Mutex
+	path    string
+	entries map[string]MemoryEntry
+}
+
+// MemoryEntry is a single translation stored in the translation memory.
+type MemoryEntry struct {
+	Backend     string `json:"backend"`
+	SourceLang  string `json:"source_lang"`
+	TargetLang  string `json:"target_lang"`
+	Source      string `json:"source"`
+	Translation string `json:"translation"`
+}
+
+// loadTranslationMemory creates a translation memory, loading the entries of the file if it exists.
+// An empty path creates a memory that only lives for the current run.
+func loadTranslationMemory(path string) (*TranslationMemory, error) {
+	memory := &TranslationMemory{path: path, entries: make(map[string]MemoryEntry)}
+	if path == "" {
+		return memory, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return memory, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []MemoryEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		memory.entries[memoryKey(entry.Backend, entry.SourceLang, entry.TargetLang, entry.Source)] = entry
+	}
+	return memory, nil
+}
+
+func memoryKey(backend, sourceLang, targetLang, source string) string {
+	return strings.Join([]string{backend, sourceLang, targetLang, strings.TrimSpace(source)}, "\x00")
+}
+
+// lookup returns the stored translation of the text for the configured backend and language pair.
+func (m *TranslationMemory) lookup(source string, config *Config) (string, bool) {
+	if m == nil || strings.TrimSpace(source) == "" {
+		return "", false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.entries[memoryKey(backendName(config), memorySourceLang(config), config.targetLang, source)]
+	return entry.Translation, ok
+}
+
+// store adds a translation of the text for the configured backend and language pair.
+func (m *TranslationMemory) store(source, translation string, config *Config) {
+	if m == nil || strings.TrimSpace(source) == "" {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry := MemoryEntry{
+		Backend:     backendName(config),
+		SourceLang:  memorySourceLang(config),
+		TargetLang:  config.targetLang,
+		Source:      strings.TrimSpace(source),
+		Translation: translation,
+	}
+	m.entries[memoryKey(entry.Backend, entry.SourceLang, entry.TargetLang, entry.Source)] = entry
+}
+
+// memorySourceLang returns the language of the text being translated,
+// which is the pivot language when translating through a pivot.
+func memorySourceLang(config *Config) string {
+	if config.pivotLang != "" {
+		return config.pivotLang
+	}
+	return config.sourceLang
+}
+
+// save writes the translation memory back to its file, if it has one.
+func (m *TranslationMemory) save() error {
+	if m == nil || m.path == "" {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Sort by key so that the file is stable between runs
+	keys := slices.Sorted(maps.Keys(m.entries))
+	entries := make([]MemoryEntry, 0, len(keys))
+	for _, key := range keys {
+		entries = append(entries, m.entries[key])
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(m.path, data, 0644)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// mergeSegments merges adjacent segments into sentence units, so that a sentence split across several short
+// cues is translated as a whole. A segment is appended to the previous unit unless the unit ends with
+// sentence-final punctuation, the gap between them is longer than maxGap, or the merged text would be longer
+// than maxChars. The merged segments are kept in the Parts field of their unit, and splitMode in its SplitMode
+// field.
+func mergeSegments(segments []SrtSegment, maxGap time.Duration, maxChars int, splitMode string) []SrtSegment {
+	var units []SrtSegment
+	var unitEnd time.Duration
+	for _, segment := range segments {
+		start, end, err := parseTimeRange(segment.Time)
+		if err != nil {
+			// Segments with an unreadable time line are left alone
+			units = append(units, segment)
+			unitEnd = -1
+			continue
+		}
+
+		if len(units) > 0 && unitEnd >= 0 {
+			unit := &units[len(units)-1]
+			if !endsSentence(unit.Text) && start-unitEnd <= maxGap &&
+				readableLength(unit.Text)+readableLength(segment.Text) <= maxChars {
+				if len(unit.Parts) == 0 {
+					unit.Parts = []SrtSegment{*unit}
+					unit.SplitMode = splitMode
+				}
+				unitStart, _, _ := parseTimeRange(unit.Time)
+				unit.Parts = append(unit.Parts, segment)
+				unit.Time = formatTimeRange(unitStart, end)
+				unit.Text = joinLines([]string{joinLines(strings.Split(unit.Text, "\n")), joinLines(strings.Split(segment.Text, "\n"))})
+				unitEnd = end
+				continue
+			}
+		}
+
+		units = append(units, segment)
+		unitEnd = end
+	}
+
+	merged := len(segments) - len(units)
+	if merged > 0 {
+		fmt.Printf("Merged %d segments into %d sentence units\n", len(segments), len(units))
+	}
+	return units
+}
+
+// endsSentence reports whether a text ends with sentence-final punctuation, possibly followed by closing quotes
+// or brackets.
+func endsSentence(text string) bool {
+	text = strings.TrimRightFunc(text, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.In(r, unicode.Pe, unicode.Pf) || r == '"' || r == '\''
+	})
+	if text == "" {
+		return false
+	}
+	last := []rune(text)[len([]rune(text))-1]
+	return strings.ContainsRune(".!?。！？…‼⁇⁈⁉", last)
+}
+
+// splitMergedSegments splits the translated sentence units back into the original segments. The translation of
+// a unit is distributed across its segments in proportion to their duration, or to the length of their source
+// text if the SplitMode of the unit is "length". Returns the original segments and their translations.
+func splitMergedSegments(units []SrtSegment, results []SrtSegment) ([]SrtSegment, []SrtSegment) {
+	var segments, splitResults []SrtSegment
+	for i, unit := range units {
+		if len(unit.Parts) == 0 {
+			segments = append(segments, unit)
+			splitResults = append(splitResults, results[i])
+			continue
+		}
+
+		weights := make([]float64, len(unit.Parts))
+		for k, part := range unit.Parts {
+			weights[k] = float64(readableLength(part.Text))
+			if unit.SplitMode != "length" {
+				if start, end, err := parseTimeRange(part.Time); err == nil && end > start {
+					weights[k] = float64(end - start)
+				}
+			}
+		}
+
+		var texts, drafts []string
+		if results[i].Err == nil {
+			texts = splitTextProportionally(results[i].Text, weights)
+			if results[i].Draft != "" {
+				drafts = splitTextProportionally(results[i].Draft, weights)
+			}
+		}
+		for k, part := range unit.Parts {
+			result := results[i]
+			result.ID = part.ID
+			result.Time = part.Time
+			if texts != nil {
+				result.Text = texts[k]
+			} else {
+				result.Text = part.Text
+			}
+			if drafts != nil {
+				result.Draft = drafts[k]
+			}
+			segments = append(segments, part)
+			splitResults = append(splitResults, result)
+		}
+	}
+	return segments, splitResults
+}
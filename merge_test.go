@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// segmentsOf builds segments numbered from 1 from pairs of time line and text.
+func segmentsOf(pairs ...string) []SrtSegment {
+	segments := make([]SrtSegment, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		segments = append(segments, SrtSegment{ID: strconv.Itoa(len(segments) + 1), Time: pairs[i], Text: pairs[i+1]})
+	}
+	return segments
+}
+
+func TestMergeSegments(t *testing.T) {
+	tests := []struct {
+		name     string
+		segments []SrtSegment
+		maxChars int
+		times    []string // Time lines of the units
+		texts    []string // Texts of the units
+		parts    []int    // Number of merged segments of each unit, 0 if it was not merged
+	}{
+		{
+			name: "fragments of a sentence",
+			segments: segmentsOf(
+				"00:00:01,000 --> 00:00:02,000", "I think",
+				"00:00:02,100 --> 00:00:03,000", "that we\nshould go.",
+				"00:00:03,200 --> 00:00:04,000", "Really?"),
+			maxChars: 80,
+			times:    []string{"00:00:01,000 --> 00:00:03,000", "00:00:03,200 --> 00:00:04,000"},
+			texts:    []string{"I think that we should go.", "Really?"},
+			parts:    []int{2, 0},
+		},
+		{
+			name: "full-width text joined without spaces",
+			segments: segmentsOf(
+				"00:00:01,000 --> 00:00:02,000", "我觉得",
+				"00:00:02,100 --> 00:00:03,000", "我们该走了。"),
+			maxChars: 80,
+			times:    []string{"00:00:01,000 --> 00:00:03,000"},
+			texts:    []string{"我觉得我们该走了。"},
+			parts:    []int{2},
+		},
+		{
+			name: "sentence end followed by a closing quote",
+			segments: segmentsOf(
+				"00:00:01,000 --> 00:00:02,000", `He said "stop."`,
+				"00:00:02,100 --> 00:00:03,000", "and left"),
+			maxChars: 80,
+			times:    []string{"00:00:01,000 --> 00:00:02,000", "00:00:02,100 --> 00:00:03,000"},
+			texts:    []string{`He said "stop."`, "and left"},
+			parts:    []int{0, 0},
+		},
+		{
+			name: "gap too long",
+			segments: segmentsOf(
+				"00:00:01,000 --> 00:00:02,000", "I think",
+				"00:00:02,600 --> 00:00:03,000", "so"),
+			maxChars: 80,
+			times:    []string{"00:00:01,000 --> 00:00:02,000", "00:00:02,600 --> 00:00:03,000"},
+			texts:    []string{"I think", "so"},
+			parts:    []int{0, 0},
+		},
+		{
+			name: "merged text too long",
+			segments: segmentsOf(
+				"00:00:01,000 --> 00:00:02,000", "I think",
+				"00:00:02,100 --> 00:00:03,000", "that we",
+				"00:00:03,100 --> 00:00:04,000", "should"),
+			maxChars: 12,
+			times:    []string{"00:00:01,000 --> 00:00:03,000", "00:00:03,100 --> 00:00:04,000"},
+			texts:    []string{"I think that we", "should"},
+			parts:    []int{2, 0},
+		},
+		{
+			name: "unreadable time line left alone",
+			segments: segmentsOf(
+				"00:00:01,000 --> 00:00:02,000", "I think",
+				"bad", "that",
+				"00:00:02,100 --> 00:00:03,000", "we",
+				"00:00:03,100 --> 00:00:04,000", "should go."),
+			maxChars: 80,
+			times:    []string{"00:00:01,000 --> 00:00:02,000", "bad", "00:00:02,100 --> 00:00:04,000"},
+			texts:    []string{"I think", "that", "we should go."},
+			parts:    []int{0, 0, 2},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			units := mergeSegments(test.segments, 300*time.Millisecond, test.maxChars, "duration")
+			var times, texts []string
+			var parts []int
+			for _, unit := range units {
+				times = append(times, unit.Time)
+				texts = append(texts, unit.Text)
+				parts = append(parts, len(unit.Parts))
+			}
+			if !slices.Equal(times, test.times) || !slices.Equal(texts, test.texts) || !slices.Equal(parts, test.parts) {
+				t.Errorf("got units %q %q with parts %v, want %q %q with parts %v", times, texts, parts, test.times, test.texts, test.parts)
+			}
+		})
+	}
+}
+
+func TestSplitMergedSegments(t *testing.T) {
+	segments := segmentsOf(
+		"00:00:01,000 --> 00:00:02,000", "one",
+		"00:00:02,000 --> 00:00:03,000", "two three four",
+		"00:00:06,000 --> 00:00:07,000", "alone")
+
+	tests := []struct {
+		name     string
+		mode     string
+		result   SrtSegment // Translation of the merged unit
+		want     []string
+		wantErrs int
+	}{
+		{"by duration", "duration", SrtSegment{Text: "un deux trois quatre"}, []string{"un deux", "trois quatre", "seul"}, 0},
+		{"by length", "length", SrtSegment{Text: "un deux trois quatre"}, []string{"un", "deux trois quatre", "seul"}, 0},
+		{"by length of uneven parts", "length", SrtSegment{Text: "一二三四五六七八九十"}, []string{"一二", "三四五六七八九十", "seul"}, 0},
+		{"failed unit keeps the source text", "duration", SrtSegment{Text: "", Err: errors.New("failed")}, []string{"one", "two three four", "seul"}, 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			units := mergeSegments(slices.Clone(segments), time.Second, 80, test.mode)
+			if len(units) != 2 {
+				t.Fatalf("got %d units, want 2", len(units))
+			}
+			results := []SrtSegment{test.result, {ID: units[1].ID, Time: units[1].Time, Text: "seul"}}
+			results[0].ID, results[0].Time = units[0].ID, units[0].Time
+
+			originals, split := splitMergedSegments(units, results)
+			if len(originals) != len(segments) || len(split) != len(segments) {
+				t.Fatalf("got %d segments and %d results, want %d", len(originals), len(split), len(segments))
+			}
+			var texts []string
+			errs := 0
+			for i, result := range split {
+				if originals[i].Time != segments[i].Time || result.Time != segments[i].Time || result.ID != segments[i].ID {
+					t.Errorf("result %d is %s %q, want %s %q", i, result.ID, result.Time, segments[i].ID, segments[i].Time)
+				}
+				texts = append(texts, result.Text)
+				if result.Err != nil {
+					errs++
+				}
+			}
+			if !slices.Equal(texts, test.want) || errs != test.wantErrs {
+				t.Errorf("got %q with %d errors, want %q with %d errors", texts, errs, test.want, test.wantErrs)
+			}
+		})
+	}
+}
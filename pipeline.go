@@ -0,0 +1,391 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ProcessingStep is a step of the preprocessing or postprocessing pipeline.
+type ProcessingStep interface {
+	// process returns the processed segments. In postprocessing, originals holds the source segments of the
+	// translated segments, in preprocessing it is nil.
+	process(segments []SrtSegment, originals []SrtSegment, config *Config) ([]SrtSegment, error)
+}
+
+// stepFunc adapts a function to the ProcessingStep interface.
+type stepFunc func(segments []SrtSegment, originals []SrtSegment, config *Config) ([]SrtSegment, error)
+
+func (f stepFunc) process(segments []SrtSegment, originals []SrtSegment, config *Config) ([]SrtSegment, error) {
+	return f(segments, originals, config)
+}
+
+const (
+	preStage  = "pre"
+	postStage = "post"
+)
+
+// stepDefinition registers a processing step under a name. create builds the step from its options, with the
+// values of the matching command line flags as defaults.
+type stepDefinition struct {
+	name        string
+	stage       string
+	description string
+	create      func(options *stepOptions, config *Config) (ProcessingStep, error)
+}
+
+// processingSteps lists the available steps. New steps only need to be added here.
+var processingSteps = []stepDefinition{
+	{
+		name:        "repeat",
+		stage:       preStage,
+		description: "reduce patterns of 2 to 6 characters repeated more than twice to two instances",
+		create: func(options *stepOptions, config *Config) (ProcessingStep, error) {
+			return stepFunc(func(segments, _ []SrtSegment, _ *Config) ([]SrtSegment, error) {
+				return reduceRepeatedPatterns(segments), nil
+			}), nil
+		},
+	},
+	{
+		name:        "single-char",
+		stage:       preStage,
+		description: "remove subtitles made of a single repeated character",
+		create: func(options *stepOptions, config *Config) (ProcessingStep, error) {
+			return stepFunc(func(segments, _ []SrtSegment, _ *Config) ([]SrtSegment, error) {
+				return deleteSrtSegmentsOnlyContainsRepeatedCharacters(segments), nil
+			}), nil
+		},
+	},
+	{
+		name:        "extend",
+		stage:       preStage,
+		description: "extend subtitles shorter than 1.2 seconds",
+		create: func(options *stepOptions, config *Config) (ProcessingStep, error) {
+			return stepFunc(func(segments, _ []SrtSegment, _ *Config) ([]SrtSegment, error) {
+				return extendSegments(segments), nil
+			}), nil
+		},
+	},
+	{
+		name:        "trim-annotation",
+		stage:       postStage,
+		description: "discard translated lines beyond the number of original lines",
+		create: func(options *stepOptions, config *Config) (ProcessingStep, error) {
+			return stepFunc(func(segments, originals []SrtSegment, _ *Config) ([]SrtSegment, error) {
+				return trimAnnotation(originals, segments), nil
+			}), nil
+		},
+	},
+	{
+		name:        "hallucination",
+		stage:       preStage,
+		description: "remove likely Whisper hallucinations, options: file, log, max_cps, min_cps (cues of 15 seconds or more)",
+		create: func(options *stepOptions, config *Config) (ProcessingStep, error) {
+			file := options.string("file", config.hallucinationFile)
+			logPath := options.string("log", config.removedLog)
+			maxCPS, err := options.float("max_cps", defaultMaxPlausibleCPS)
+			if err != nil {
+				return nil, err
+			}
+			minCPS, err := options.float("min_cps", defaultMinPlausibleCPSLongCues)
+			if err != nil {
+				return nil, err
+			}
+			if maxCPS <= 0 {
+				return nil, fmt.Errorf("invalid max_cps option of step hallucination: %v, must be positive", maxCPS)
+			}
+			if minCPS < 0 {
+				return nil, fmt.Errorf("invalid min_cps option of step hallucination: %v, must not be negative", minCPS)
+			}
+			return stepFunc(func(segments, _ []SrtSegment, config *Config) ([]SrtSegment, error) {
+				phrases, err := loadHallucinationPhrases(config.sourceLang, file)
+				if err != nil {
+					return nil, err
+				}
+				segments, removed := filterHallucinations(segments, phrases, maxCPS, minCPS)
+				if len(removed) > 0 && config.dryRun {
+					fmt.Printf("Would remove %d likely hallucinated segments\n", len(removed))
+				} else if len(removed) > 0 {
+					path := logPath
+					if path == "" {
+						base := config.outputBase
+						if base == "" {
+							base = strings.TrimSuffix(config.sourceSrt, filepath.Ext(config.sourceSrt))
+						}
+						path = base + ".removed.log"
+					}
+					if err := writeRemovedLog(path, removed); err != nil {
+						return nil, err
+					}
+					fmt.Printf("Removed %d likely hallucinated segments, listed in %s\n", len(removed), path)
+				}
+				return segments, nil
+			}), nil
+		},
+	},
+	{
+		name:        "split",
+		stage:       preStage,
+		description: "split long subtitles, options: duration (seconds), chars",
+		create: func(options *stepOptions, config *Config) (ProcessingStep, error) {
+			duration, err := options.float("duration", config.splitDuration)
+			if err != nil {
+				return nil, err
+			}
+			chars, err := options.int("chars", config.splitMaxChars)
+			if err != nil {
+				return nil, err
+			}
+			return stepFunc(func(segments, _ []SrtSegment, _ *Config) ([]SrtSegment, error) {
+				return splitLongSegments(segments, time.Duration(duration*float64(time.Second)), chars), nil
+			}), nil
+		},
+	},
+	{
+		name:        "merge",
+		stage:       preStage,
+		description: "merge fragmented subtitles into sentences for translation, options: gap (milliseconds), chars, split (duration or length)",
+		create: func(options *stepOptions, config *Config) (ProcessingStep, error) {
+			gap, err := options.int("gap", config.mergeGap)
+			if err != nil {
+				return nil, err
+			}
+			chars, err := options.int("chars", config.mergeMaxChars)
+			if err != nil {
+				return nil, err
+			}
+			mode := options.string("split", config.mergeSplit)
+			if mode != "duration" && mode != "length" {
+				return nil, fmt.Errorf("invalid merge split mode %q, options: duration, length", mode)
+			}
+			return stepFunc(func(segments, _ []SrtSegment, _ *Config) ([]SrtSegment, error) {
+				return mergeSegments(segments, time.Duration(gap)*time.Millisecond, chars, mode), nil
+			}), nil
+		},
+	},
+	{
+		name:        "repair",
+		stage:       preStage,
+		description: "make the timings monotonic and free of overlaps, options: gap, duration, snap (milliseconds, gaps under snap are closed)",
+		create: func(options *stepOptions, config *Config) (ProcessingStep, error) {
+			gap, err := options.int("gap", 40)
+			if err != nil {
+				return nil, err
+			}
+			duration, err := options.int("duration", 500)
+			if err != nil {
+				return nil, err
+			}
+			snap, err := options.int("snap", 100)
+			if err != nil {
+				return nil, err
+			}
+			return stepFunc(func(segments, _ []SrtSegment, _ *Config) ([]SrtSegment, error) {
+				segments, changes, err := repairTimings(segments, time.Duration(gap)*time.Millisecond,
+					time.Duration(duration)*time.Millisecond, time.Duration(snap)*time.Millisecond)
+				if err != nil {
+					return nil, err
+				}
+				if len(changes) > 0 {
+					fmt.Printf("Repaired the timings:\n%s\n", strings.Join(changes, "\n"))
+				}
+				return segments, nil
+			}), nil
+		},
+	},
+	{
+		name:        "wrap",
+		stage:       postStage,
+		description: "re-wrap lines and check the readability limits, options: width, lines, cps, shorten",
+		create: func(options *stepOptions, config *Config) (ProcessingStep, error) {
+			width, err := options.int("width", config.maxLineWidth)
+			if err != nil {
+				return nil, err
+			}
+			lines, err := options.int("lines", config.maxLines)
+			if err != nil {
+				return nil, err
+			}
+			cps, err := options.float("cps", config.maxCPS)
+			if err != nil {
+				return nil, err
+			}
+			shorten, err := options.bool("shorten", config.shorten)
+			if err != nil {
+				return nil, err
+			}
+			if shorten && config.translator != "openai" {
+				return nil, fmt.Errorf("shortening requires the 'openai' translator")
+			}
+			return stepFunc(func(segments, _ []SrtSegment, config *Config) ([]SrtSegment, error) {
+				wrapConfig := *config
+				wrapConfig.maxLineWidth = width
+				wrapConfig.maxLines = lines
+				wrapConfig.maxCPS = cps
+				wrapConfig.shorten = shorten
+				return enforceReadability(segments, &wrapConfig), nil
+			}), nil
+		},
+	},
+}
+
+// stepOptions holds the options of a step, given as "name:key=value:key=value".
+type stepOptions struct {
+	step   string
+	values map[string]string
+	used   map[string]bool
+}
+
+func (o *stepOptions) string(key string, defaultValue string) string {
+	o.used[key] = true
+	if value, ok := o.values[key]; ok {
+		return value
+	}
+	return defaultValue
+}
+
+func (o *stepOptions) int(key string, defaultValue int) (int, error) {
+	value := o.string(key, strconv.Itoa(defaultValue))
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s option of step %s: %q", key, o.step, value)
+	}
+	return n, nil
+}
+
+func (o *stepOptions) float(key string, defaultValue float64) (float64, error) {
+	value := o.string(key, strconv.FormatFloat(defaultValue, 'f', -1, 64))
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s option of step %s: %q", key, o.step, value)
+	}
+	return f, nil
+}
+
+func (o *stepOptions) bool(key string, defaultValue bool) (bool, error) {
+	value := o.string(key, strconv.FormatBool(defaultValue))
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s option of step %s: %q", key, o.step, value)
+	}
+	return b, nil
+}
+
+// parsePipeline builds the steps of a comma-separated pipeline such as "hallucination,repeat,extend:..." for
+// the given stage.
+func parsePipeline(spec string, stage string, config *Config) ([]ProcessingStep, error) {
+	var steps []ProcessingStep
+	merged := false
+	for _, item := range splitList(spec) {
+		fields := strings.Split(item, ":")
+		name := strings.TrimSpace(fields[0])
+		if merged {
+			// The steps would see sentence units, whose translation is split back into the original segments
+			return nil, fmt.Errorf("%s cannot run after merge, merge must be the last preprocessing step", name)
+		}
+		merged = name == "merge"
+
+		var definition *stepDefinition
+		for i := range processingSteps {
+			if processingSteps[i].name == name {
+				definition = &processingSteps[i]
+				break
+			}
+		}
+		if definition == nil {
+			return nil, fmt.Errorf("unknown processing step %q, available:\n%s", name, describeSteps(stage))
+		}
+		if definition.stage != stage {
+			return nil, fmt.Errorf("%s is a %sprocessing step", name, definition.stage)
+		}
+
+		options := &stepOptions{step: name, values: make(map[string]string), used: make(map[string]bool)}
+		for _, field := range fields[1:] {
+			key, value, ok := strings.Cut(field, "=")
+			if !ok {
+				return nil, fmt.Errorf("invalid option %q of step %s, expected key=value", field, name)
+			}
+			options.values[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+
+		step, err := definition.create(options, config)
+		if err != nil {
+			return nil, err
+		}
+		for key := range options.values {
+			if !options.used[key] {
+				return nil, fmt.Errorf("unknown option %q of step %s", key, name)
+			}
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// runPipeline applies the steps in order.
+func runPipeline(steps []ProcessingStep, segments []SrtSegment, originals []SrtSegment, config *Config) ([]SrtSegment, error) {
+	var err error
+	for _, step := range steps {
+		segments, err = step.process(segments, originals, config)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return segments, nil
+}
+
+// stepNames lists the names of the steps of a stage, in registration order.
+func stepNames(stage string) string {
+	var names []string
+	for _, definition := range processingSteps {
+		if definition.stage == stage {
+			names = append(names, definition.name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// describeSteps lists the steps of a stage with their description, one per line.
+func describeSteps(stage string) string {
+	var lines []string
+	for _, definition := range processingSteps {
+		if definition.stage == stage {
+			lines = append(lines, "  "+definition.name+": "+definition.description)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// legacyPipeline returns the pipeline equivalent to the numbered preprocessing or postprocessing flags, used
+// when no pipeline is given.
+func legacyPipeline(stage string, config *Config) string {
+	var names []string
+	if stage == preStage {
+		enabled := []struct {
+			flag bool
+			name string
+		}{
+			{config.preProcessing1, "repeat"},
+			{config.preProcessing2, "single-char"},
+			{config.preProcessing6, "hallucination"},
+			{config.preProcessing5, "split"},
+			{config.preProcessing3, "extend"},
+			{config.preProcessing4, "merge"},
+		}
+		for _, step := range enabled {
+			if step.flag {
+				names = append(names, step.name)
+			}
+		}
+	} else {
+		if config.postProcessing1 {
+			names = append(names, "trim-annotation")
+		}
+		if config.postProcessing2 {
+			names = append(names, "wrap")
+		}
+	}
+	return strings.Join(names, ",")
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParsePipeline(t *testing.T) {
+	tests := []struct {
+		name  string
+		spec  string
+		stage string
+		steps int
+		err   string // Part of the expected error, if any
+	}{
+		{name: "empty", spec: "", stage: preStage},
+		{name: "names", spec: "repeat,single-char,extend", stage: preStage, steps: 3},
+		{name: "spaces and empty items", spec: " repeat , ,extend ", stage: preStage, steps: 2},
+		{name: "options", spec: "repair:gap=80:snap=200,merge:gap=300:split=length", stage: preStage, steps: 2},
+		{name: "spaces around options", spec: "repair: gap = 80 ", stage: preStage, steps: 1},
+		{name: "postprocessing", spec: "trim-annotation,wrap:width=32:cps=9", stage: postStage, steps: 2},
+		{name: "unknown step", spec: "repeat,nope", stage: preStage, err: `unknown processing step "nope"`},
+		{name: "step of the other stage", spec: "wrap", stage: preStage, err: "wrap is a postprocessing step"},
+		{name: "unknown option", spec: "repair:width=3", stage: preStage, err: `unknown option "width" of step repair`},
+		{name: "option without value", spec: "repair:gap", stage: preStage, err: `invalid option "gap" of step repair`},
+		{name: "invalid number", spec: "repair:gap=wide", stage: preStage, err: "invalid gap option of step repair"},
+		{name: "invalid merge split mode", spec: "merge:split=sentence", stage: preStage, err: "invalid merge split mode"},
+		{name: "merge last", spec: "repeat,merge", stage: preStage, steps: 2},
+		{name: "step after merge", spec: "merge,repair", stage: preStage, err: "repair cannot run after merge"},
+		{name: "merge after merge", spec: "merge,merge", stage: preStage, err: "merge cannot run after merge"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := Config{mergeGap: 500, mergeMaxChars: 80, mergeSplit: "duration", maxCPS: 17}
+			steps, err := parsePipeline(test.spec, test.stage, &config)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got error %v, want one containing %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(steps) != test.steps {
+				t.Errorf("got %d steps, want %d", len(steps), test.steps)
+			}
+		})
+	}
+}
+
+func TestParsePipelineAppliesOptions(t *testing.T) {
+	steps, err := parsePipeline("repair:gap=200:duration=0:snap=0", preStage, &Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	segments := []SrtSegment{
+		{ID: "1", Time: "00:00:01,000 --> 00:00:02,000"},
+		{ID: "2", Time: "00:00:02,000 --> 00:00:03,000"},
+	}
+	segments, err = runPipeline(steps, segments, nil, &Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "00:00:01,000 --> 00:00:01,800"; segments[0].Time != want {
+		t.Errorf("first segment has time %q, want %q with a gap of 200ms", segments[0].Time, want)
+	}
+}
+
+func TestLegacyPipeline(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		pre    string
+		post   string
+	}{
+		{"none", Config{}, "", ""},
+		{"defaults", Config{preProcessing3: true, postProcessing1: true}, "extend", "trim-annotation"},
+		{
+			name: "all in order",
+			config: Config{preProcessing1: true, preProcessing2: true, preProcessing3: true, preProcessing4: true,
+				preProcessing5: true, preProcessing6: true, postProcessing1: true, postProcessing2: true},
+			pre:  "repeat,single-char,hallucination,split,extend,merge",
+			post: "trim-annotation,wrap",
+		},
+		{"split before extend", Config{preProcessing3: true, preProcessing5: true}, "split,extend", ""},
+		{"wrap only", Config{postProcessing2: true}, "", "wrap"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := legacyPipeline(preStage, &test.config); got != test.pre {
+				t.Errorf("legacyPipeline(pre) = %q, want %q", got, test.pre)
+			}
+			if got := legacyPipeline(postStage, &test.config); got != test.post {
+				t.Errorf("legacyPipeline(post) = %q, want %q", got, test.post)
+			}
+		})
+	}
+}
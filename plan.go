@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// BatchPlan describes a single request that would be sent to the translator.
+type BatchPlan struct {
+	StartIndex        int
+	EndIndex          int
+	CombinedText      string
+	CombinedReference string
+	Characters        int
+	InputTokens       int
+	OutputTokens      int
+}
+
+// planBatches splits the segments into batches exactly like translateSrtSegmentsInBatches does,
+// without sending anything. It returns an error if a single segment is too large to fit in a batch.
+func planBatches(segments []SrtSegment, referenceSegments []SrtSegment, config *Config) ([]BatchPlan, error) {
+	var plans []BatchPlan
+
+	for startIndex := 0; startIndex < len(segments); {
+		combinedText, combinedReference, endIndex := combineText(segments, referenceSegments, startIndex, int(config.maxTokens))
+
+		if combinedText == "" {
+			return plans, fmt.Errorf("single segment too large to process: ID %s, %d characters",
+				segments[startIndex].ID, len(segments[startIndex].Text))
+		}
+
+		prompt := combinedText
+		if _, ok := config.TranslatorImpl.(*OpenAITranslator); ok {
+			messages, err := buildMessages(planRequest(segments, referenceSegments, startIndex, endIndex, config), config)
+			if err != nil {
+				return plans, err
+			}
+			prompt = ""
+			for _, message := range messages {
+				prompt += message.Content
+			}
+		}
+
+		plans = append(plans, BatchPlan{
+			StartIndex:        startIndex,
+			EndIndex:          endIndex,
+			CombinedText:      combinedText,
+			CombinedReference: combinedReference,
+			Characters:        utf8.RuneCountInString(combinedText),
+			InputTokens:       estimateTokens(prompt),
+			OutputTokens:      estimateTokens(combinedText), // The answer repeats the blocks in the target language
+		})
+
+		startIndex = endIndex // Move to next batch
+	}
+
+	return plans, nil
+}
+
+// planRequest returns the request that would be sent for segments[startIndex:endIndex].
+func planRequest(segments []SrtSegment, referenceSegments []SrtSegment, startIndex, endIndex int, config *Config) TranslationRequest {
+	batchReference := referenceSegments[min(startIndex, len(referenceSegments)):min(endIndex, len(referenceSegments))]
+	text, reference, _ := combineText(segments[startIndex:endIndex], batchReference, 0, math.MaxInt)
+	return TranslationRequest{
+		Text:       text,
+		Reference:  reference,
+		Segments:   segments[startIndex:endIndex],
+		References: batchReference,
+		Context:    batchContext(segments, startIndex, endIndex, config.contextLines),
+	}
+}
+
+// printTranslationPlan prints the batches that would be sent, a sample prompt and the projected time and cost.
+func printTranslationPlan(segments []SrtSegment, referenceSegments []SrtSegment, config *Config) {
+	// Every target language is a separate pass over the same batches
+	languageConfigs := configsForTargetLanguages(config)
+	if len(languageConfigs) == 0 {
+		checkError(fmt.Errorf("no target language"))
+	}
+	config = &languageConfigs[0]
+	plans, err := planBatches(segments, referenceSegments, config)
+
+	fmt.Printf("Source: %s\n", config.sourceSrt)
+	for _, languageConfig := range languageConfigs {
+		fmt.Printf("Destination (%s): %s\n", languageConfig.targetLang, languageConfig.destSrt)
+	}
+	fmt.Printf("Translator: %s", config.translator)
+	if config.modelName != "" {
+		fmt.Printf(" (model: %s)", config.modelName)
+	}
+	fmt.Printf("\nSegments after preprocessing: %d\n", len(segments))
+	fmt.Printf("Batches: %d\n\n", len(plans))
+
+	fmt.Printf("%-6s %-10s %-14s %-11s %-12s %-12s\n", "Batch", "Segments", "IDs", "Characters", "Input tok.", "Output tok.")
+	var inputTokens, outputTokens int
+	for i, plan := range plans {
+		ids := segments[plan.StartIndex].ID + "-" + segments[plan.EndIndex-1].ID
+		fmt.Printf("%-6d %-10d %-14s %-11d %-12d %-12d\n",
+			i+1, plan.EndIndex-plan.StartIndex, ids, plan.Characters, plan.InputTokens, plan.OutputTokens)
+		inputTokens += plan.InputTokens
+		outputTokens += plan.OutputTokens
+	}
+	checkError(err)
+
+	if len(plans) > 0 {
+		fmt.Println("\nSample prompt (batch 1):")
+		if _, ok := config.TranslatorImpl.(*OpenAITranslator); ok {
+			messages, err := buildMessages(planRequest(segments, referenceSegments, plans[0].StartIndex, plans[0].EndIndex, config), config)
+			checkError(err)
+			for _, message := range messages {
+				fmt.Printf("--- %s ---\n%s\n", message.Role, message.Content)
+			}
+		} else {
+			fmt.Printf("%s\n", plans[0].CombinedText)
+		}
+	}
+
+	// Requests are paced by a ticker firing maxRequestsPerMinute times per minute, shared by all languages.
+	passes := len(languageConfigs)
+	if config.pivotLang != "" {
+		passes++ // The pivot translation is made once for all languages
+	}
+	if config.referenceTranslator != "" {
+		passes *= 2 // The reference is translated for each language before the main translation
+	}
+	passes *= max(candidateCount(config), 1)
+	batchInput, batchOutput := inputTokens, outputTokens
+	inputTokens *= passes
+	outputTokens *= passes
+	requests := len(plans) * passes
+
+	// The checks below are made on the translation into each language, with about one request per batch
+	languages := len(languageConfigs)
+	checks := []string{fmt.Sprintf("%d translation", passes)}
+	if candidateCount(config) > 1 && config.selectMode == "judge" {
+		// The judge reads the source with every candidate and answers with candidate numbers
+		inputTokens += languages * (batchInput + candidateCount(config)*batchOutput)
+		requests += languages * len(plans)
+		checks = append(checks, fmt.Sprintf("%d judge", languages))
+	}
+	if config.review {
+		// The reviewer reads the source with the draft and returns the corrected translation
+		inputTokens += languages * (batchInput + batchOutput)
+		outputTokens += languages * batchOutput
+		requests += languages * len(plans)
+		checks = append(checks, fmt.Sprintf("%d review", languages))
+	}
+	if config.qaMode == "backtranslate" {
+		if config.qaTranslator == "openai" {
+			inputTokens += languages * batchInput // The translation is sent back in place of the source
+			outputTokens += languages * batchOutput
+		}
+		requests += languages * len(plans)
+		checks = append(checks, fmt.Sprintf("%d back-translation", languages))
+	}
+
+	interval := time.Minute / time.Duration(config.maxRequestsPerMinute)
+	projectedTime := time.Duration(requests) * interval
+	fmt.Printf("\nPasses: %s\n", strings.Join(checks, ", "))
+	fmt.Printf("Estimated requests: %d, tokens: %d input, %d output\n", requests, inputTokens, outputTokens)
+	fmt.Printf("Projected time: %s at %d requests per minute (without retries)\n",
+		projectedTime.Round(time.Second), config.maxRequestsPerMinute)
+	if config.qaRetranslateModel != "" {
+		fmt.Println("Segments re-translated after the quality check are not included")
+	}
+
+	if config.inputPrice > 0 || config.outputPrice > 0 {
+		cost := float64(inputTokens)/1e6*config.inputPrice + float64(outputTokens)/1e6*config.outputPrice
+		fmt.Printf("Projected cost: %.4f (%.4f per million input tokens, %.4f per million output tokens)\n",
+			cost, config.inputPrice, config.outputPrice)
+	} else {
+		fmt.Println("Projected cost: unknown, set --inputprice and --outputprice to project it")
+	}
+}
+
+// estimateTokens roughly estimates the number of tokens in a text without a tokenizer.
+// CJK characters are counted as one token each, other characters as one token per four characters.
+func estimateTokens(s string) int {
+	var wide, other int
+	for _, r := range s {
+		if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) {
+			wide++
+		} else {
+			other++
+		}
+	}
+	return wide + (other+3)/4
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/language/display"
+)
+
+// TranslationRequest is a batch of segments sent to the translator, with everything a prompt can show.
+type TranslationRequest struct {
+	Text       string       // Segments in SRT form
+	Reference  string       // Reference segments in SRT form, empty if there is no reference
+	Segments   []SrtSegment // Segments of the batch
+	References []SrtSegment // Reference segments of the batch, if any
+	Context    BatchContext
+}
+
+// BatchContext holds the source segments around a batch, which are not translated but help understand it.
+type BatchContext struct {
+	Before []SrtSegment
+	After  []SrtSegment
+}
+
+// batchContext returns up to lines segments before and after segments[start:end].
+func batchContext(segments []SrtSegment, start, end, lines int) BatchContext {
+	if lines <= 0 {
+		return BatchContext{}
+	}
+	return BatchContext{
+		Before: segments[max(start-lines, 0):start],
+		After:  segments[end:min(end+lines, len(segments))],
+	}
+}
+
+// samplePromptRequest returns a small but complete request, used to check a prompt template before any work is
+// done: templates may index the segments, so an empty request would fail on valid templates.
+func samplePromptRequest() TranslationRequest {
+	segments := []SrtSegment{
+		{ID: "1", Time: "00:00:01,000 --> 00:00:02,000", Text: "Sample line"},
+		{ID: "2", Time: "00:00:02,000 --> 00:00:03,000", Text: "Another sample line"},
+	}
+	references := []SrtSegment{
+		{ID: "1", Time: segments[0].Time, Text: "Sample reference"},
+		{ID: "2", Time: segments[1].Time, Text: "Another sample reference"},
+	}
+	return TranslationRequest{
+		Text:       formatSegments(segments),
+		Reference:  formatSegments(references),
+		Segments:   segments,
+		References: references,
+		Context: BatchContext{
+			Before: []SrtSegment{{ID: "0", Time: "00:00:00,000 --> 00:00:01,000", Text: "Previous line"}},
+			After:  []SrtSegment{{ID: "3", Time: "00:00:03,000 --> 00:00:04,000", Text: "Next line"}},
+		},
+	}
+}
+
+// ChatMessage is a message of the conversation sent to the AI.
+type ChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// PromptData is what prompt templates can use.
+type PromptData struct {
+	TranslationRequest
+	Glossary       []GlossaryEntry // Glossary entries whose term appears in the batch
+	Examples       []Example       // Examples chosen for the batch, empty when rendering an example
+	Title          string
+	Notes          string
+	SystemPrompt   string
+	SourceLang     string
+	TargetLang     string
+	PivotLang      string
+	SourceLangName string // English name of the language, e.g. "Japanese"
+	TargetLangName string
+	PivotLangName  string
+}
+
+// messageMarkerRegex matches the lines starting a new message in the output of a prompt template.
+var messageMarkerRegex = regexp.MustCompile(`(?m)^--- *(system|user|assistant) *---[ \t]*$`)
+
+// promptFuncs are the functions available in prompt templates.
+var promptFuncs = template.FuncMap{
+	"srt":      formatSegments,
+	"langName": languageName,
+	"join":     strings.Join,
+	"text": func(segments []SrtSegment) string {
+		texts := make([]string, len(segments))
+		for i, segment := range segments {
+			texts[i] = segment.Text
+		}
+		return strings.Join(texts, "\n")
+	},
+}
+
+// loadPromptTemplate parses a prompt template file written with text/template.
+func loadPromptTemplate(path string) (*template.Template, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return template.New(path).Funcs(promptFuncs).Option("missingkey=error").Parse(string(data))
+}
+
+// buildMessages returns the conversation sent to the AI for a request. With a prompt template, the template
+// output is split into messages at lines such as "--- system ---", "--- user ---" or "--- assistant ---"; an
+// output without such lines is a single user message after the system prompt. Without a template, the system
+// prompt is followed by the user prompt. The examples chosen for the request are inserted as previous turns
+// before the user message, unless the template writes its own messages and lays them out with .Examples.
+func buildMessages(request TranslationRequest, config *Config) ([]ChatMessage, error) {
+	examples := selectExamples(config.examples, request.Segments, config.examplesK)
+	if config.pivotLang != "" {
+		examples = nil // The text is in the pivot language, not in the language of the examples
+	}
+
+	prompt := func(request TranslationRequest) (string, error) {
+		return buildUserPrompt(request, config), nil
+	}
+	output, err := prompt(request)
+	if config.promptTemplate != nil {
+		prompt = func(request TranslationRequest) (string, error) {
+			return executePromptTemplate(newPromptData(request, config), config)
+		}
+		data := newPromptData(request, config)
+		data.Examples = examples
+		output, err = executePromptTemplate(data, config)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if config.promptTemplate != nil && messageMarkerRegex.MatchString(output) {
+		return splitMessages(output)
+	}
+
+	var messages []ChatMessage
+	if config.systemPrompt != "" {
+		messages = append(messages, ChatMessage{Role: "system", Content: config.systemPrompt})
+	}
+	turns, err := exampleMessages(examples, prompt)
+	if err != nil {
+		return nil, err
+	}
+	messages = append(messages, turns...)
+	return append(messages, ChatMessage{Role: "user", Content: strings.TrimSpace(output)}), nil
+}
+
+// executePromptTemplate writes the prompt template with the given data.
+func executePromptTemplate(data PromptData, config *Config) (string, error) {
+	var output strings.Builder
+	if err := config.promptTemplate.Execute(&output, data); err != nil {
+		return "", fmt.Errorf("failed to execute the prompt template: %w", err)
+	}
+	return output.String(), nil
+}
+
+// splitMessages splits the output of a prompt template into messages.
+func splitMessages(output string) ([]ChatMessage, error) {
+	markers := messageMarkerRegex.FindAllStringSubmatchIndex(output, -1)
+	if strings.TrimSpace(output[:markers[0][0]]) != "" {
+		return nil, fmt.Errorf("the prompt template writes text before its first message marker")
+	}
+	var messages []ChatMessage
+	for k, marker := range markers {
+		end := len(output)
+		if k+1 < len(markers) {
+			end = markers[k+1][0]
+		}
+		messages = append(messages, ChatMessage{
+			Role:    output[marker[2]:marker[3]],
+			Content: strings.TrimSpace(output[marker[1]:end]),
+		})
+	}
+	if messages[len(messages)-1].Role != "user" {
+		return nil, fmt.Errorf("the last message of the prompt template must be a user message")
+	}
+	return messages, nil
+}
+
+func newPromptData(request TranslationRequest, config *Config) PromptData {
+	return PromptData{
+		TranslationRequest: request,
+		Glossary:           glossaryHits(config.glossary, request.Text),
+		Title:              config.title,
+		Notes:              config.notes,
+		SystemPrompt:       config.systemPrompt,
+		SourceLang:         config.sourceLang,
+		TargetLang:         config.targetLang,
+		PivotLang:          config.pivotLang,
+		SourceLangName:     languageName(config.sourceLang),
+		TargetLangName:     languageName(config.targetLang),
+		PivotLangName:      languageName(config.pivotLang),
+	}
+}
+
+// formatSegments writes segments in SRT form, as they are sent to the translator.
+func formatSegments(segments []SrtSegment) string {
+	blocks := make([]string, len(segments))
+	for i, segment := range segments {
+		blocks[i] = formatSegment(segment)
+	}
+	return strings.Join(blocks, "\n\n")
+}
+
+// languageName returns the English name of a language code, such as "Traditional Chinese" for "zh-TW", or the
+// code itself if it is unknown.
+func languageName(code string) string {
+	if code == "" {
+		return ""
+	}
+	tag, err := language.Parse(code)
+	if err != nil {
+		return code
+	}
+	if name := display.English.Tags().Name(tag); name != "" {
+		return name
+	}
+	return code
+}
+
+// GlossaryEntry is a term and its imposed translation.
+type GlossaryEntry struct {
+	Term        string
+	Translation string
+}
+
+// loadGlossary reads a glossary file with one "term<TAB>translation" or "term = translation" entry per line.
+// Empty lines and lines starting with # are ignored.
+func loadGlossary(path string) ([]GlossaryEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var glossary []GlossaryEntry
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		term, translation, ok := strings.Cut(line, "\t")
+		if !ok {
+			term, translation, ok = strings.Cut(line, "=")
+		}
+		if !ok || strings.TrimSpace(term) == "" {
+			return nil, fmt.Errorf("%s:%d: expected term<TAB>translation or term = translation", path, lineNumber)
+		}
+		glossary = append(glossary, GlossaryEntry{strings.TrimSpace(term), strings.TrimSpace(translation)})
+	}
+	return glossary, scanner.Err()
+}
+
+// glossaryHits returns the glossary entries whose term appears in the text, ignoring case.
+func glossaryHits(glossary []GlossaryEntry, text string) []GlossaryEntry {
+	var hits []GlossaryEntry
+	lower := strings.ToLower(text)
+	for _, entry := range glossary {
+		if strings.Contains(lower, strings.ToLower(entry.Term)) {
+			hits = append(hits, entry)
+		}
+	}
+	return hits
+}
+
+// formatGlossary writes glossary entries one per line as "term: translation".
+func formatGlossary(entries []GlossaryEntry) string {
+	lines := make([]string, len(entries))
+	for i, entry := range entries {
+		lines[i] = entry.Term + ": " + entry.Translation
+	}
+	return strings.Join(lines, "\n")
+}
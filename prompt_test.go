@@ -0,0 +1,137 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestBuildMessages(t *testing.T) {
+	segment := SrtSegment{ID: "1", Time: "00:00:05,000 --> 00:00:06,000", Text: "Bonjour"}
+	request := TranslationRequest{Text: formatSegment(segment), Segments: []SrtSegment{segment}}
+	examples := []Example{{Source: "Merci", Translation: "Thanks"}}
+	exampleUser := "Translate: 1\n00:00:01,000 --> 00:00:03,000\nMerci"
+	exampleAssistant := "1\n00:00:01,000 --> 00:00:03,000\nThanks"
+	user := "Translate: " + request.Text
+
+	tests := []struct {
+		name      string
+		template  string // Prompt template, the user prompt is used if empty
+		examples  []Example
+		pivotLang string
+		want      []ChatMessage
+		err       string // Part of the expected error, if any
+	}{
+		{
+			name: "user prompt",
+			want: []ChatMessage{{"system", "System"}, {"user", user}},
+		},
+		{
+			name:     "examples as previous turns",
+			examples: examples,
+			want:     []ChatMessage{{"system", "System"}, {"user", exampleUser}, {"assistant", exampleAssistant}, {"user", user}},
+		},
+		{
+			name:      "examples dropped with a pivot language",
+			examples:  examples,
+			pivotLang: "en",
+			want:      []ChatMessage{{"system", "System"}, {"user", user}},
+		},
+		{
+			name:     "template without markers",
+			template: "Translate: {{.Text}}\n",
+			examples: examples,
+			want:     []ChatMessage{{"system", "System"}, {"user", exampleUser}, {"assistant", exampleAssistant}, {"user", user}},
+		},
+		{
+			name:     "template with markers",
+			template: "--- system ---\nBe brief.\n\n---  user  --- \nTranslate: {{.Text}}\n",
+			examples: examples,
+			want:     []ChatMessage{{"system", "Be brief."}, {"user", user}},
+		},
+		{
+			name: "template laying out the examples",
+			template: "--- system ---\n{{.SystemPrompt}}\n{{range .Examples}}--- user ---\n{{.Source}}\n--- assistant ---\n" +
+				"{{.Translation}}\n{{end}}--- user ---\nTranslate: {{.Text}}",
+			examples: examples,
+			want:     []ChatMessage{{"system", "System"}, {"user", "Merci"}, {"assistant", "Thanks"}, {"user", user}},
+		},
+		{
+			name:     "marker inside a line",
+			template: "Translate: {{.Text}} --- user ---",
+			want:     []ChatMessage{{"system", "System"}, {"user", user + " --- user ---"}},
+		},
+		{
+			name:     "text before the first marker",
+			template: "Hello\n--- user ---\n{{.Text}}",
+			err:      "before its first message marker",
+		},
+		{
+			name:     "assistant message last",
+			template: "--- user ---\n{{.Text}}\n--- assistant ---\nSure",
+			err:      "must be a user message",
+		},
+		{
+			name:     "unknown field",
+			template: "{{.Subtitles}}",
+			err:      "failed to execute the prompt template",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := Config{
+				systemPrompt: "System",
+				userPrompt:   "Translate: <ot>",
+				examples:     test.examples,
+				pivotLang:    test.pivotLang,
+			}
+			if test.template != "" {
+				config.promptTemplate = template.Must(
+					template.New(test.name).Funcs(promptFuncs).Option("missingkey=error").Parse(test.template))
+			}
+			messages, err := buildMessages(request, &config)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("got error %v, want one containing %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(messages, test.want) {
+				t.Errorf("got messages %q, want %q", messages, test.want)
+			}
+		})
+	}
+}
+
+func TestSamplePromptRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		err      string
+	}{
+		{"segments indexed", "{{(index .Segments 0).Text}}", ""},
+		{"references indexed", "{{(index .References 0).Text}}", ""},
+		{"context indexed", "{{(index .Context.Before 0).Text}} {{(index .Context.After 0).Text}}", ""},
+		{"text", "{{.Text}}\n{{srt .Segments}}\n{{text .Segments}}", ""},
+		{"unknown field", "{{.Subtitles}}", "can't evaluate field Subtitles"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := Config{promptTemplate: template.Must(
+				template.New(test.name).Funcs(promptFuncs).Option("missingkey=error").Parse(test.template))}
+			_, err := buildMessages(samplePromptRequest(), &config)
+			if test.err == "" && err != nil {
+				t.Errorf("got error %v", err)
+			}
+			if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+				t.Errorf("got error %v, want %q", err, test.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+)
+
+// QualityCheck is the result of the back-translation quality check of a segment.
+type QualityCheck struct {
+	Score           float64 `json:"score"`
+	BackTranslation string  `json:"back_translation"`
+	Retranslated    bool    `json:"retranslated,omitempty"`
+	PreviousText    string  `json:"previous_text,omitempty"` // Translation replaced by the re-translation
+	PreviousScore   float64 `json:"previous_score,omitempty"`
+}
+
+// checkQuality translates the result back into the source language with the quality check backend and scores
+// the similarity of every segment with the original. The lowest-scoring segments are listed, and if a
+// re-translation model is configured, segments scoring below the threshold are translated again with it.
+func checkQuality(segments []SrtSegment, results []SrtSegment, config *Config) []SrtSegment {
+	qaConfig := *config.qaBackend
+	qaConfig.sourceLang = config.targetLang
+	qaConfig.targetLang = config.sourceLang
+
+	fmt.Printf("Back-translating the %s translation with %s\n", config.targetLang, backendName(&qaConfig))
+	scores := backTranslate(segments, results, allIndices(results), &qaConfig)
+	scored := make([]int, 0, len(scores))
+	for i := range results {
+		if check, ok := scores[i]; ok {
+			results[i].Quality = check
+			scored = append(scored, i)
+		}
+	}
+
+	// Re-translate the worst segments with another model, keeping whichever scores better
+	if config.retranslateBackend != nil {
+		var low []int
+		for _, i := range scored {
+			if results[i].Quality.Score < config.qaThreshold {
+				low = append(low, i)
+			}
+		}
+		if len(low) > 0 {
+			retranslateLowScores(segments, results, low, config, &qaConfig)
+		}
+	}
+
+	// List the lowest-scoring segments
+	slices.SortStableFunc(scored, func(a, b int) int {
+		return cmp.Compare(results[a].Quality.Score, results[b].Quality.Score)
+	})
+	fmt.Printf("Lowest back-translation scores (%s):\n", config.targetLang)
+	for _, i := range scored[:min(config.qaLowest, len(scored))] {
+		fmt.Printf("ID %s score %.2f\n%s\n%s\n%s\n", results[i].ID, results[i].Quality.Score,
+			segments[i].Text, results[i].Text, results[i].Quality.BackTranslation)
+	}
+
+	return results
+}
+
+// retranslateLowScores translates the given segments again with the re-translation model and keeps the new
+// translation when its back-translation scores better than the previous one.
+func retranslateLowScores(segments []SrtSegment, results []SrtSegment, indices []int, config *Config, qaConfig *Config) {
+	retranslateConfig := *config.retranslateBackend
+	retranslateConfig.targetLang = config.targetLang
+	retranslateConfig.title = config.title
+	retranslateConfig.memory = config.memory
+
+	fmt.Printf("Re-translating %d low-scoring segments with %s\n", len(indices), backendName(&retranslateConfig))
+	subset := make([]SrtSegment, len(indices))
+	for n, i := range indices {
+		subset[n] = segments[i]
+	}
+	retranslated := translateSrtSegmentsInBatches(subset, nil, &retranslateConfig)
+	if retranslated == nil {
+		return
+	}
+
+	candidates := make([]SrtSegment, len(results))
+	copy(candidates, results)
+	for n, i := range indices {
+		candidates[i] = retranslated[n]
+	}
+	scores := backTranslate(segments, candidates, indices, qaConfig)
+
+	for _, i := range indices {
+		check, ok := scores[i]
+		if !ok || check.Score <= results[i].Quality.Score {
+			continue
+		}
+		check.Retranslated = true
+		check.PreviousText = results[i].Text
+		check.PreviousScore = results[i].Quality.Score
+		results[i].Text = candidates[i].Text
+		results[i].Backend = candidates[i].Backend
+		results[i].Attempts += candidates[i].Attempts
+		results[i].Quality = check
+	}
+}
+
+// backTranslate translates the given results back into the source language and scores them against the
+// originals. Failed segments are skipped. Returns the quality check of each scored segment by index.
+func backTranslate(segments []SrtSegment, results []SrtSegment, indices []int, qaConfig *Config) map[int]*QualityCheck {
+	var subset []SrtSegment
+	var subsetIndices []int
+	for _, i := range indices {
+		if results[i].Err == nil && results[i].Text != "" {
+			subset = append(subset, results[i])
+			subsetIndices = append(subsetIndices, i)
+		}
+	}
+
+	scores := make(map[int]*QualityCheck)
+	backTranslations := translateSrtSegmentsInBatches(subset, nil, qaConfig)
+	for n, i := range subsetIndices {
+		if backTranslations == nil || backTranslations[n].Err != nil {
+			continue
+		}
+		scores[i] = &QualityCheck{
+			Score:           textSimilarity(segments[i].Text, backTranslations[n].Text),
+			BackTranslation: backTranslations[n].Text,
+		}
+	}
+	return scores
+}
+
+func allIndices(segments []SrtSegment) []int {
+	indices := make([]int, len(segments))
+	for i := range indices {
+		indices[i] = i
+	}
+	return indices
+}
+
+// textSimilarity scores the similarity of two texts from 0 to 1 with the Dice coefficient of their character
+// bigrams, after normalization. Texts of a single character are compared as unigrams.
+func textSimilarity(a, b string) float64 {
+	a = normalizeForComparison(a)
+	b = normalizeForComparison(b)
+	if a == b {
+		return 1
+	}
+
+	gramsA := characterNgrams(a)
+	gramsB := characterNgrams(b)
+	if len(gramsA) == 0 || len(gramsB) == 0 {
+		return 0
+	}
+
+	counts := make(map[string]int)
+	for _, gram := range gramsA {
+		counts[gram]++
+	}
+	common := 0
+	for _, gram := range gramsB {
+		if counts[gram] > 0 {
+			counts[gram]--
+			common++
+		}
+	}
+	return 2 * float64(common) / float64(len(gramsA)+len(gramsB))
+}
+
+// characterNgrams returns the character bigrams of a text, or its single character.
+func characterNgrams(s string) []string {
+	runes := []rune(s)
+	if len(runes) == 1 {
+		return []string{s}
+	}
+	grams := make([]string, 0, len(runes))
+	for i := 0; i+1 < len(runes); i++ {
+		grams = append(grams, string(runes[i:i+2]))
+	}
+	return grams
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestTextSimilarity(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want float64
+	}{
+		{"identical after normalization", "Hello, world!", "hello world", 1},
+		{"nothing in common", "abc", "xyz", 0},
+		{"one bigram in common", "night", "nacht", 0.25},
+		{"repeated bigrams counted once each", "aaaa", "aa", 0.5},
+		{"full-width", "你好吗", "你好", 2.0 / 3},
+		{"single character", "a", "ab", 0},
+		{"punctuation only", "...", "?", 1},
+		{"empty", "", "text", 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := textSimilarity(test.a, test.b); math.Abs(got-test.want) > 1e-9 {
+				t.Errorf("textSimilarity(%q, %q) = %f, want %f", test.a, test.b, got, test.want)
+			}
+		})
+	}
+}
+
+func TestCheckQuality(t *testing.T) {
+	segments := segmentsOf(
+		"00:00:01,000 --> 00:00:02,000", "Good morning",
+		"00:00:03,000 --> 00:00:04,000", "Thank you",
+		"00:00:05,000 --> 00:00:06,000", "Goodbye",
+		"00:00:07,000 --> 00:00:08,000", "Failed",
+	)
+	results := []SrtSegment{
+		{ID: "1", Time: segments[0].Time, Text: "Bonjour"},
+		{ID: "2", Time: segments[1].Time, Text: "Merci"},
+		{ID: "3", Time: segments[2].Time, Text: "Adieu"},
+		{ID: "4", Time: segments[3].Time, Text: "Failed", Err: errors.New("failed")},
+	}
+	backTranslations := map[string]string{
+		"Bonjour":        "Good morning",
+		"Merci":          "Thanks",
+		"Merci beaucoup": "Thank you",
+		"Adieu":          "Farewell",
+		"Salut":          "Hi",
+	}
+	retranslations := map[string]string{"Thank you": "Merci beaucoup", "Goodbye": "Salut"}
+	config := Config{
+		sourceLang:         "en",
+		targetLang:         "fr",
+		qaLowest:           2,
+		qaThreshold:        0.8,
+		qaBackend:          fakeBackend("qa", func(text, _ string) string { return backTranslations[text] }),
+		retranslateBackend: fakeBackend("retranslate", func(text, _ string) string { return retranslations[text] }),
+	}
+
+	results = checkQuality(segments, results, &config)
+	if results[0].Quality == nil || results[0].Quality.Score != 1 || results[0].Quality.Retranslated {
+		t.Errorf("good translation got %+v", results[0].Quality)
+	}
+	if check := results[1].Quality; results[1].Text != "Merci beaucoup" || check == nil || !check.Retranslated ||
+		check.Score != 1 || check.PreviousText != "Merci" || math.Abs(check.PreviousScore-2.0/3) > 1e-9 {
+		t.Errorf("re-translated segment got %q with %+v", results[1].Text, check)
+	}
+	if check := results[2].Quality; results[2].Text != "Adieu" || check == nil || check.Retranslated || check.BackTranslation != "Farewell" {
+		t.Errorf("segment with a worse re-translation got %q with %+v", results[2].Text, check)
+	}
+	if results[3].Quality != nil {
+		t.Errorf("failed segment got %+v", results[3].Quality)
+	}
+}
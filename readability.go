@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/width"
+)
+
+// enforceReadability re-wraps translated lines that are too wide, at punctuation when possible, and checks the
+// number of lines and the reading speed of every segment. If shortening is enabled, segments still violating
+// the limits are sent to the AI to be shortened. Remaining violations are recorded in the Violations field.
+func enforceReadability(results []SrtSegment, config *Config) []SrtSegment {
+	var violating []int
+	for i := range results {
+		if results[i].Err != nil {
+			continue
+		}
+		results[i].Text = wrapText(results[i].Text, config.maxLineWidth)
+		if violations := readabilityViolations(results[i], config); len(violations) > 0 {
+			violating = append(violating, i)
+		}
+	}
+
+	if config.shorten && len(violating) > 0 {
+		shortenSegments(results, violating, config)
+	}
+
+	for _, i := range violating {
+		results[i].Violations = readabilityViolations(results[i], config)
+	}
+	return results
+}
+
+// readabilityViolations lists the limits exceeded by a segment.
+func readabilityViolations(segment SrtSegment, config *Config) []string {
+	var violations []string
+	lines := strings.Split(segment.Text, "\n")
+	if config.maxLines > 0 && len(lines) > config.maxLines {
+		violations = append(violations, fmt.Sprintf("%d lines, maximum %d", len(lines), config.maxLines))
+	}
+	if config.maxLineWidth > 0 {
+		for _, line := range lines {
+			if w := textWidth(line); w > config.maxLineWidth {
+				violations = append(violations, fmt.Sprintf("line width %d, maximum %d", w, config.maxLineWidth))
+				break
+			}
+		}
+	}
+	if config.maxCPS > 0 {
+		if cps, ok := charactersPerSecond(segment); ok && cps > config.maxCPS {
+			violations = append(violations, fmt.Sprintf("%.1f characters per second, maximum %.1f", cps, config.maxCPS))
+		}
+	}
+	return violations
+}
+
+// charactersPerSecond returns the reading speed of a segment, counting characters other than spaces.
+func charactersPerSecond(segment SrtSegment) (float64, bool) {
+	start, end, err := parseTimeRange(segment.Time)
+	if err != nil || end <= start {
+		return 0, false
+	}
+	return float64(readableLength(segment.Text)) / (end - start).Seconds(), true
+}
+
+// readableLength counts the characters of a text, ignoring spaces and line breaks.
+func readableLength(s string) int {
+	count := 0
+	for _, r := range s {
+		if !unicode.IsSpace(r) {
+			count++
+		}
+	}
+	return count
+}
+
+// maxReadableLength returns how many characters a segment may contain within the line and reading speed limits.
+func maxReadableLength(segment SrtSegment, config *Config) int {
+	limit := math.MaxInt
+	if config.maxLineWidth > 0 && config.maxLines > 0 {
+		// Full-width text is the worst case, two units per character
+		perLine := config.maxLineWidth
+		if strings.ContainsFunc(segment.Text, isWide) {
+			perLine /= 2
+		}
+		limit = perLine * config.maxLines
+	}
+	if start, end, err := parseTimeRange(segment.Time); config.maxCPS > 0 && err == nil && end > start {
+		limit = min(limit, int(config.maxCPS*(end-start).Seconds()))
+	}
+	return max(limit, 1)
+}
+
+// shortenSegments asks the AI to shorten the given segments to fit their limits, and re-wraps the results.
+// The shortened text replaces the translation only if it is actually shorter.
+func shortenSegments(results []SrtSegment, indices []int, config *Config) {
+	shortenConfig := *config
+	shortenConfig.userPrompt = config.shortenPrompt
+	shortenConfig.promptTemplate = nil
+	shortenConfig.examples = nil
+	shortenConfig.sourceLang = config.targetLang // Same language in and out, so an unchanged line is not an echo
+	shortenConfig.memory = nil
+	shortenConfig.referenceBackend = nil
+	shortenConfig.pivotLang = ""
+
+	requests := make([]SrtSegment, len(indices))
+	for n, i := range indices {
+		requests[n] = SrtSegment{
+			ID:   results[i].ID,
+			Time: results[i].Time,
+			Text: fmt.Sprintf("[%d] %s", maxReadableLength(results[i], config), joinLines(strings.Split(results[i].Text, "\n"))),
+		}
+	}
+
+	fmt.Printf("Shortening %d %s segments exceeding the readability limits\n", len(indices), config.targetLang)
+	shortened := translateSrtSegmentsInBatches(requests, nil, &shortenConfig)
+	if shortened == nil {
+		return
+	}
+	for n, i := range indices {
+		if shortened[n].Err != nil {
+			continue
+		}
+		text := wrapText(strings.TrimSpace(shortened[n].Text), config.maxLineWidth)
+		if text != "" && readableLength(text) < readableLength(results[i].Text) {
+			results[i].Text = text
+		}
+	}
+}
+
+// wrapText joins the lines of a text and breaks it again so that no line is wider than maxWidth, in as few
+// lines as possible, balanced, and preferably after punctuation. Text with spaces is only broken at spaces.
+// Text that already fits is returned unchanged.
+func wrapText(text string, maxWidth int) string {
+	if maxWidth <= 0 {
+		return text
+	}
+	lines := strings.Split(text, "\n")
+	fits := true
+	for _, line := range lines {
+		if textWidth(line) > maxWidth {
+			fits = false
+			break
+		}
+	}
+	if fits {
+		return text
+	}
+
+	joined := joinLines(lines)
+
+	// Try a balanced split first, then fall back to filling lines greedily
+	count := (textWidth(joined) + maxWidth - 1) / maxWidth
+	weights := make([]float64, count)
+	for k := range weights {
+		weights[k] = 1
+	}
+	parts := splitTextProportionally(joined, weights)
+	for _, part := range parts {
+		if textWidth(part) > maxWidth || part == "" {
+			return strings.Join(greedyWrap(joined, maxWidth), "\n")
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// joinLines joins subtitle lines into one, without a space between full-width characters.
+func joinLines(lines []string) string {
+	joined := strings.TrimSpace(lines[0])
+	for _, line := range lines[1:] {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		last := []rune(joined)
+		if len(last) > 0 && isWide(last[len(last)-1]) && isWide([]rune(line)[0]) {
+			joined += line
+		} else {
+			joined += " " + line
+		}
+	}
+	return joined
+}
+
+// greedyWrap fills each line as much as possible, preferring to break after punctuation in the last third of
+// the line. A word wider than maxWidth is kept on its own line.
+func greedyWrap(text string, maxWidth int) []string {
+	runes := []rune(text)
+	hasSpaces := strings.ContainsFunc(text, unicode.IsSpace)
+	var lines []string
+
+	for len(runes) > 0 {
+		if textWidth(string(runes)) <= maxWidth {
+			lines = append(lines, strings.TrimSpace(string(runes)))
+			break
+		}
+
+		cut, punctuationCut, lineWidth := -1, -1, 0
+		for i := 1; i < len(runes); i++ {
+			lineWidth += runeWidth(runes[i-1])
+			if lineWidth > maxWidth {
+				break
+			}
+			allowed := !unicode.IsPunct(runes[i])
+			if hasSpaces {
+				allowed = unicode.IsSpace(runes[i-1]) || unicode.IsSpace(runes[i])
+			}
+			if !allowed {
+				continue
+			}
+			cut = i
+			if unicode.IsPunct(runes[i-1]) || (i > 1 && unicode.IsSpace(runes[i-1]) && unicode.IsPunct(runes[i-2])) {
+				if lineWidth*3 >= maxWidth*2 {
+					punctuationCut = i
+				}
+			}
+		}
+		if punctuationCut > 0 {
+			cut = punctuationCut
+		}
+		if cut < 0 {
+			// No break allowed within the width, break at the first allowed position
+			cut = strings.IndexFunc(string(runes), unicode.IsSpace)
+			if cut < 0 {
+				lines = append(lines, string(runes))
+				break
+			}
+			cut = len([]rune(string(runes)[:cut]))
+		}
+		lines = append(lines, strings.TrimSpace(string(runes[:cut])))
+		runes = []rune(strings.TrimSpace(string(runes[cut:])))
+	}
+	return lines
+}
+
+// textWidth returns the display width of a text, full-width characters counting as two.
+func textWidth(s string) int {
+	w := 0
+	for _, r := range s {
+		w += runeWidth(r)
+	}
+	return w
+}
+
+func runeWidth(r rune) int {
+	if isWide(r) {
+		return 2
+	}
+	return 1
+}
+
+// isWide reports whether a character is displayed full-width, like CJK characters.
+func isWide(r rune) bool {
+	kind := width.LookupRune(r).Kind()
+	return kind == width.EastAsianWide || kind == width.EastAsianFullwidth
+}
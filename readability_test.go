@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestWrapText(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		maxWidth int
+		want     string
+	}{
+		{"no limit", "one two three four five six", 0, "one two three four five six"},
+		{"fits", "one two\nthree", 10, "one two\nthree"},
+		{"balanced", "one two three four five six", 15, "one two three\nfour five six"},
+		{"lines joined before wrapping", "one two three four\nfive six", 15, "one two three\nfour five six"},
+		{"full-width", "我们今天晚上一起去吃饭吧", 16, "我们今天晚上\n一起去吃饭吧"},
+		{"full-width lines joined without space", "我们今天晚上一起\n去吃饭吧", 14, "我们今天晚上\n一起去吃饭吧"},
+		{"word wider than the limit", "supercalifragilistic is long", 10, "supercalifragilistic\nis long"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := wrapText(test.text, test.maxWidth); got != test.want {
+				t.Errorf("wrapText(%q, %d) = %q, want %q", test.text, test.maxWidth, got, test.want)
+			}
+		})
+	}
+}
+
+func TestTextWidth(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"abc def", 7},
+		{"中文", 4},
+		{"한글", 4},
+		{"ａｂ", 4},
+		{"中文ok", 6},
+	}
+
+	for _, test := range tests {
+		if got := textWidth(test.text); got != test.want {
+			t.Errorf("textWidth(%q) = %d, want %d", test.text, got, test.want)
+		}
+	}
+}
+
+func TestJoinLines(t *testing.T) {
+	tests := []struct {
+		lines []string
+		want  string
+	}{
+		{[]string{"Hello", "world"}, "Hello world"},
+		{[]string{"中文", "字幕"}, "中文字幕"},
+		{[]string{"中文", "ok"}, "中文 ok"},
+		{[]string{" a ", "", " b"}, "a b"},
+	}
+
+	for _, test := range tests {
+		if got := joinLines(test.lines); got != test.want {
+			t.Errorf("joinLines(%q) = %q, want %q", test.lines, got, test.want)
+		}
+	}
+}
+
+func TestReadabilityViolations(t *testing.T) {
+	config := Config{maxLineWidth: 10, maxLines: 2, maxCPS: 5}
+	tests := []struct {
+		name    string
+		segment SrtSegment
+		want    []string // Start of each violation
+	}{
+		{"within the limits", SrtSegment{Time: "00:00:01,000 --> 00:00:04,000", Text: "one two\nthree"}, nil},
+		{"too many lines", SrtSegment{Time: "00:00:01,000 --> 00:00:04,000", Text: "one\ntwo\nthree"}, []string{"3 lines"}},
+		{"line too wide", SrtSegment{Time: "00:00:01,000 --> 00:00:04,000", Text: "我们今天晚上"}, []string{"line width 12"}},
+		{"too fast", SrtSegment{Time: "00:00:01,000 --> 00:00:02,000", Text: "one two"}, []string{"6.0 characters per second"}},
+		{"unreadable time line", SrtSegment{Time: "bad", Text: "one two"}, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			violations := readabilityViolations(test.segment, &config)
+			if len(violations) != len(test.want) {
+				t.Fatalf("got violations %q, want %q", violations, test.want)
+			}
+			for i, violation := range violations {
+				if !strings.HasPrefix(violation, test.want[i]) {
+					t.Errorf("got violation %q, want %q", violation, test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMaxReadableLength(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		segment SrtSegment
+		want    int
+	}{
+		{"no limit", Config{}, SrtSegment{Time: "00:00:01,000 --> 00:00:03,000", Text: "text"}, math.MaxInt},
+		{"lines", Config{maxLineWidth: 20, maxLines: 2}, SrtSegment{Time: "00:00:01,000 --> 00:00:03,000", Text: "text"}, 40},
+		{"full-width lines", Config{maxLineWidth: 20, maxLines: 2}, SrtSegment{Time: "00:00:01,000 --> 00:00:03,000", Text: "文字"}, 20},
+		{"reading speed", Config{maxLineWidth: 20, maxLines: 2, maxCPS: 5}, SrtSegment{Time: "00:00:01,000 --> 00:00:03,000", Text: "text"}, 10},
+		{"at least one", Config{maxCPS: 0.1}, SrtSegment{Time: "00:00:01,000 --> 00:00:02,000", Text: "text"}, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := maxReadableLength(test.segment, &test.config); got != test.want {
+				t.Errorf("maxReadableLength = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestEnforceReadability(t *testing.T) {
+	config := Config{maxLineWidth: 16, maxLines: 2, maxCPS: 8}
+	results := []SrtSegment{
+		{Time: "00:00:01,000 --> 00:00:04,000", Text: "我们今天晚上一起去吃饭吧"},
+		{Time: "00:00:05,000 --> 00:00:06,000", Text: "我们今天晚上一起去吃饭吧"},
+		{Time: "00:00:07,000 --> 00:00:08,000", Text: "failed", Err: errors.New("failed")},
+	}
+	results = enforceReadability(results, &config)
+
+	if want := "我们今天晚上\n一起去吃饭吧"; results[0].Text != want || len(results[0].Violations) != 0 {
+		t.Errorf("got %q with violations %q, want %q without", results[0].Text, results[0].Violations, want)
+	}
+	if len(results[1].Violations) != 1 || !strings.Contains(results[1].Violations[0], "characters per second") {
+		t.Errorf("got violations %q, want the reading speed", results[1].Violations)
+	}
+	if results[2].Text != "failed" || len(results[2].Violations) != 0 {
+		t.Errorf("failed segment changed to %q with violations %q", results[2].Text, results[2].Violations)
+	}
+}
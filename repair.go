@@ -0,0 +1,106 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// repairTimings makes the timings monotonic and free of overlaps. Segments are sorted by start time, renumbered
+// if that changed their order, and then:
+//   - a gap shorter than snapGap is closed: the end is moved to the start of the next segment;
+//   - otherwise a segment starting less than minGap after the end of the previous one is moved later, and the end
+//     is moved to minGap before the next segment when it overlaps it or leaves a shorter gap;
+//   - a segment shorter than minDuration is extended, without getting closer than minGap to the next segment
+//     unless the two are snapped together.
+//
+// Returns a description of every change.
+func repairTimings(segments []SrtSegment, minGap, minDuration, snapGap time.Duration) ([]SrtSegment, []string, error) {
+	type timing struct{ start, end time.Duration }
+	timings := make([]timing, len(segments))
+	for i, segment := range segments {
+		start, end, err := parseTimeRange(segment.Time)
+		if err != nil {
+			return nil, nil, fmt.Errorf("segment %s: %w", segment.ID, err)
+		}
+		timings[i] = timing{start, end}
+	}
+
+	var changes []string
+	order := allIndices(segments)
+	slices.SortStableFunc(order, func(a, b int) int { return cmp.Compare(timings[a].start, timings[b].start) })
+	if !slices.IsSorted(order) {
+		sorted := make([]SrtSegment, len(segments))
+		sortedTimings := make([]timing, len(segments))
+		for n, i := range order {
+			sorted[n] = segments[i]
+			sorted[n].ID = fmt.Sprintf("%d", n+1)
+			sortedTimings[n] = timings[i]
+		}
+		segments, timings = sorted, sortedTimings
+		changes = append(changes, "segments sorted by start time and renumbered")
+	}
+
+	snapped := false // Whether the previous segment ends where this one starts
+	for i := range segments {
+		start, end := timings[i].start, timings[i].end
+		var reasons []string
+
+		if i > 0 && !snapped && start < timings[i-1].end+minGap {
+			start = timings[i-1].end + minGap
+			reasons = append(reasons, "moved after the previous segment")
+		}
+		if end < start {
+			end = start
+			reasons = append(reasons, "end before start")
+		}
+
+		limit := time.Duration(-1)
+		snapped = false
+		if i+1 < len(segments) {
+			next := timings[i+1].start
+			limit = next - minGap
+			if gap := next - end; gap < 0 {
+				reasons = append(reasons, "overlapped the next segment")
+				end = limit
+			} else if gap < snapGap && next > start {
+				if gap > 0 {
+					reasons = append(reasons, fmt.Sprintf("gap of %s to the next segment closed", gap))
+				}
+				end, limit, snapped = next, next, true
+			} else if gap < minGap {
+				reasons = append(reasons, fmt.Sprintf("gap of %s to the next segment widened to %s", gap, minGap))
+				end = limit
+			}
+		}
+		if end-start < minDuration {
+			extended := start + minDuration
+			if limit >= 0 && extended > limit {
+				extended = max(limit, end)
+			}
+			if extended != end {
+				end = extended
+				reasons = append(reasons, "extended to the minimum duration")
+			}
+		}
+		if end <= start {
+			// No room left before the next segment, which is moved later in turn
+			end = start + minDuration
+			if minDuration == 0 {
+				end = start + time.Millisecond
+			}
+			reasons = append(reasons, fmt.Sprintf("no room before the next segment, lasts %s", end-start))
+		}
+
+		if start != timings[i].start || end != timings[i].end {
+			changes = append(changes, fmt.Sprintf("%s: %s -> %s (%s)", segments[i].ID,
+				formatTimeRange(timings[i].start, timings[i].end), formatTimeRange(start, end), strings.Join(reasons, ", ")))
+			segments[i].Time = formatTimeRange(start, end)
+		}
+		timings[i] = timing{start, end}
+	}
+
+	return segments, changes, nil
+}
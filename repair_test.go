@@ -0,0 +1,161 @@
+package main
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRepairTimings(t *testing.T) {
+	const ms = time.Millisecond
+	tests := []struct {
+		name        string
+		times       []string
+		minGap      time.Duration
+		minDuration time.Duration
+		snapGap     time.Duration
+		want        []string
+		changes     int
+		reason      string // Expected in one of the changes, if set
+	}{
+		{
+			name:  "already valid",
+			times: []string{"00:00:01,000 --> 00:00:02,000", "00:00:03,000 --> 00:00:04,000"},
+			want:  []string{"00:00:01,000 --> 00:00:02,000", "00:00:03,000 --> 00:00:04,000"},
+		},
+		{
+			name:    "overlap",
+			times:   []string{"00:00:01,000 --> 00:00:02,500", "00:00:02,000 --> 00:00:03,000"},
+			minGap:  100 * ms,
+			want:    []string{"00:00:01,000 --> 00:00:01,900", "00:00:02,000 --> 00:00:03,000"},
+			changes: 1,
+		},
+		{
+			name:    "unsorted",
+			times:   []string{"00:00:03,000 --> 00:00:04,000", "00:00:01,000 --> 00:00:02,000"},
+			want:    []string{"00:00:01,000 --> 00:00:02,000", "00:00:03,000 --> 00:00:04,000"},
+			changes: 1,
+		},
+		{
+			name:    "short gap closed",
+			times:   []string{"00:00:01,000 --> 00:00:02,000", "00:00:02,020 --> 00:00:03,000"},
+			minGap:  40 * ms,
+			snapGap: 100 * ms,
+			want:    []string{"00:00:01,000 --> 00:00:02,020", "00:00:02,020 --> 00:00:03,000"},
+			changes: 1,
+			reason:  "gap of 20ms to the next segment closed",
+		},
+		{
+			name:    "touching segments kept snapped",
+			times:   []string{"00:00:01,000 --> 00:00:02,000", "00:00:02,000 --> 00:00:03,000"},
+			minGap:  40 * ms,
+			snapGap: 100 * ms,
+			want:    []string{"00:00:01,000 --> 00:00:02,000", "00:00:02,000 --> 00:00:03,000"},
+		},
+		{
+			name:    "short gap above the snap widened to the minimum gap",
+			times:   []string{"00:00:01,000 --> 00:00:02,000", "00:00:02,020 --> 00:00:03,000"},
+			minGap:  40 * ms,
+			snapGap: 10 * ms,
+			want:    []string{"00:00:01,000 --> 00:00:01,980", "00:00:02,020 --> 00:00:03,000"},
+			changes: 1,
+			reason:  "gap of 20ms to the next segment widened to 40ms",
+		},
+		{
+			name:        "snapped segment extended up to the next one",
+			times:       []string{"00:00:01,000 --> 00:00:01,200", "00:00:01,250 --> 00:00:03,000"},
+			minGap:      40 * ms,
+			minDuration: time.Second,
+			snapGap:     100 * ms,
+			want:        []string{"00:00:01,000 --> 00:00:01,250", "00:00:01,250 --> 00:00:03,000"},
+			changes:     1,
+		},
+		{
+			name:        "extended to the minimum duration",
+			times:       []string{"00:00:01,000 --> 00:00:01,200", "00:00:05,000 --> 00:00:06,000"},
+			minGap:      100 * ms,
+			minDuration: time.Second,
+			want:        []string{"00:00:01,000 --> 00:00:02,000", "00:00:05,000 --> 00:00:06,000"},
+			changes:     1,
+		},
+		{
+			name:        "extension stops before the next segment",
+			times:       []string{"00:00:01,000 --> 00:00:01,200", "00:00:01,500 --> 00:00:03,000"},
+			minGap:      100 * ms,
+			minDuration: time.Second,
+			want:        []string{"00:00:01,000 --> 00:00:01,400", "00:00:01,500 --> 00:00:03,000"},
+			changes:     1,
+		},
+		{
+			name:    "same start",
+			times:   []string{"00:00:01,000 --> 00:00:02,000", "00:00:01,000 --> 00:00:03,000"},
+			minGap:  100 * ms,
+			want:    []string{"00:00:01,000 --> 00:00:01,001", "00:00:01,101 --> 00:00:03,000"},
+			changes: 2,
+			reason:  "no room before the next segment",
+		},
+		{
+			name:    "end before start",
+			times:   []string{"00:00:02,000 --> 00:00:01,000"},
+			want:    []string{"00:00:02,000 --> 00:00:02,001"},
+			changes: 1,
+			reason:  "no room before the next segment, lasts 1ms",
+		},
+		{
+			name: "empty",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			segments := make([]SrtSegment, len(test.times))
+			for i, times := range test.times {
+				segments[i] = SrtSegment{ID: strconv.Itoa(i + 1), Time: times, Text: "text"}
+			}
+			repaired, changes, err := repairTimings(segments, test.minGap, test.minDuration, test.snapGap)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(repaired) != len(test.want) {
+				t.Fatalf("got %d segments, want %d", len(repaired), len(test.want))
+			}
+			for i, segment := range repaired {
+				if segment.Time != test.want[i] {
+					t.Errorf("segment %d has time %q, want %q", i, segment.Time, test.want[i])
+				}
+			}
+			if len(changes) != test.changes {
+				t.Errorf("got changes %q, want %d", changes, test.changes)
+			}
+			if test.reason != "" && !slices.ContainsFunc(changes, func(c string) bool { return strings.Contains(c, test.reason) }) {
+				t.Errorf("got changes %q, want one to mention %q", changes, test.reason)
+			}
+		})
+	}
+}
+
+func TestRepairTimingsRenumbersSortedSegments(t *testing.T) {
+	segments := []SrtSegment{
+		{ID: "1", Time: "00:00:03,000 --> 00:00:04,000", Text: "second"},
+		{ID: "2", Time: "00:00:01,000 --> 00:00:02,000", Text: "first"},
+	}
+	repaired, _, err := repairTimings(segments, 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repaired[0].ID != "1" || repaired[0].Text != "first" || repaired[1].ID != "2" || repaired[1].Text != "second" {
+		t.Errorf("got %+v, want the segments sorted by start time and renumbered", repaired)
+	}
+}
+
+func TestRepairTimingsUnparsableTime(t *testing.T) {
+	segments := []SrtSegment{
+		{ID: "1", Time: "00:00:01,000 --> 00:00:02,000"},
+		{ID: "2", Time: "00:00:03,000 -> later"},
+	}
+	if _, _, err := repairTimings(segments, 0, 0, 0); err == nil {
+		t.Error("got no error for an unparsable time line")
+	}
+}
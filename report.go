@@ -0,0 +1,139 @@
+package main
+
+import (
+	"cmp"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Report is the machine-readable summary of a translation run.
+type Report struct {
+	Source      string          `json:"source"`
+	Destination string          `json:"destination"`
+	SourceLang  string          `json:"source_lang"`
+	TargetLang  string          `json:"target_lang"`
+	Total       int             `json:"total"`
+	Failed      int             `json:"failed"`
+	QALowest    []string        `json:"qa_lowest,omitempty"` // IDs of the lowest-scoring segments
+	Segments    []SegmentReport `json:"segments"`
+}
+
+// SegmentReport describes the outcome of a single segment.
+type SegmentReport struct {
+	ID          string              `json:"id"`
+	Time        string              `json:"time"`
+	Status      string              `json:"status"`
+	Attempts    int                 `json:"attempts"`
+	Backend     string              `json:"backend"`
+	Error       string              `json:"error,omitempty"`
+	Original    string              `json:"original"`
+	Translation string              `json:"translation"`
+	Draft       string              `json:"draft,omitempty"`
+	ReviewDiff  string              `json:"review_diff,omitempty"`
+	QA          *QualityCheck       `json:"qa,omitempty"`
+	Candidates  *CandidateSelection `json:"candidates,omitempty"`
+	Violations  []string            `json:"violations,omitempty"`
+}
+
+// buildReport collects the status of every translated segment.
+func buildReport(originalSegments, translatedSegments []SrtSegment, config *Config) Report {
+	report := Report{
+		Source:      config.sourceSrt,
+		Destination: config.destSrt,
+		SourceLang:  config.sourceLang,
+		TargetLang:  config.targetLang,
+		Total:       len(translatedSegments),
+	}
+
+	for i, segment := range translatedSegments {
+		segmentReport := SegmentReport{
+			ID:          segment.ID,
+			Time:        segment.Time,
+			Status:      "ok",
+			Attempts:    segment.Attempts,
+			Backend:     segment.Backend,
+			Translation: segment.Text,
+		}
+		if i < len(originalSegments) {
+			segmentReport.Original = originalSegments[i].Text
+		}
+		if segment.Draft != "" {
+			segmentReport.Draft = segment.Draft
+			segmentReport.ReviewDiff = diffText(segment.Draft, segment.Text)
+		}
+		segmentReport.QA = segment.Quality
+		segmentReport.Candidates = segment.Candidates
+		segmentReport.Violations = segment.Violations
+		if segment.Err != nil {
+			segmentReport.Status = "failed"
+			segmentReport.Error = segment.Err.Error()
+			report.Failed++
+		}
+		report.Segments = append(report.Segments, segmentReport)
+	}
+
+	// List the lowest back-translation scores first
+	var scored []SrtSegment
+	for _, segment := range translatedSegments {
+		if segment.Quality != nil {
+			scored = append(scored, segment)
+		}
+	}
+	slices.SortStableFunc(scored, func(a, b SrtSegment) int {
+		return cmp.Compare(a.Quality.Score, b.Quality.Score)
+	})
+	for _, segment := range scored[:min(config.qaLowest, len(scored))] {
+		report.QALowest = append(report.QALowest, segment.ID)
+	}
+
+	return report
+}
+
+// writeReport writes the report as CSV if the file extension is .csv, and as JSON otherwise.
+func writeReport(filePath string, originalSegments, translatedSegments []SrtSegment, config *Config) error {
+	report := buildReport(originalSegments, translatedSegments, config)
+
+	file, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if strings.ToLower(filepath.Ext(filePath)) != ".csv" {
+		encoder := json.NewEncoder(file)
+		encoder.SetIndent("", "  ")
+		encoder.SetEscapeHTML(false)
+		return encoder.Encode(report)
+	}
+
+	writer := csv.NewWriter(file)
+	if err := writer.Write([]string{"id", "time", "status", "attempts", "backend", "error", "original", "translation", "draft", "review_diff", "qa_score", "back_translation", "candidate", "candidate_reason", "violations"}); err != nil {
+		return err
+	}
+	for _, segment := range report.Segments {
+		var score, backTranslation string
+		if segment.QA != nil {
+			score = strconv.FormatFloat(segment.QA.Score, 'f', 3, 64)
+			backTranslation = segment.QA.BackTranslation
+		}
+		var candidate, candidateReason string
+		if segment.Candidates != nil {
+			candidate = strconv.Itoa(segment.Candidates.Winner)
+			candidateReason = segment.Candidates.Reason
+		}
+		record := []string{segment.ID, segment.Time, segment.Status, strconv.Itoa(segment.Attempts),
+			segment.Backend, segment.Error, segment.Original, segment.Translation, segment.Draft, segment.ReviewDiff,
+			score, backTranslation, candidate, candidateReason, strings.Join(segment.Violations, "; ")}
+		if err := writer.Write(record); err != nil {
+			return fmt.Errorf("failed to write report: %w", err)
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
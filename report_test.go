@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func reportSegments() (originals, translated []SrtSegment) {
+	originals = segmentsOf(
+		"00:00:01,000 --> 00:00:02,000", "Bonjour",
+		"00:00:03,000 --> 00:00:04,000", "Merci, mon ami",
+		"00:00:05,000 --> 00:00:06,000", "Salut",
+	)
+	translated = []SrtSegment{
+		{ID: "1", Time: originals[0].Time, Text: "Hello", Attempts: 1, Backend: "openai:m", Quality: &QualityCheck{Score: 0.9, BackTranslation: "Bonjour"}},
+		{ID: "2", Time: originals[1].Time, Text: "Thanks, my friend", Attempts: 1, Backend: "openai:m + openai:r", Draft: "Thanks, friend",
+			Quality: &QualityCheck{Score: 0.4, BackTranslation: "Merci mon ami"}},
+		{ID: "3", Time: originals[2].Time, Text: "[!] Salut", Attempts: 3, Backend: "openai:m", Err: errors.New("failed after 3 attempts"),
+			Violations: []string{"line width 40"}},
+	}
+	return originals, translated
+}
+
+func TestWriteReportJSON(t *testing.T) {
+	originals, translated := reportSegments()
+	config := Config{sourceSrt: "in.srt", destSrt: "out.srt", sourceLang: "fr", targetLang: "en", qaLowest: 1}
+	path := filepath.Join(t.TempDir(), "report.json")
+	if err := writeReport(path, originals, translated, &config); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Source != "in.srt" || report.Destination != "out.srt" || report.Total != 3 || report.Failed != 1 {
+		t.Errorf("got report header %+v", report)
+	}
+	if !slices.Equal(report.QALowest, []string{"2"}) {
+		t.Errorf("got lowest scores %q, want [2]", report.QALowest)
+	}
+	var statuses []string
+	for _, segment := range report.Segments {
+		statuses = append(statuses, segment.Status)
+	}
+	if want := []string{"ok", "ok", "failed"}; !slices.Equal(statuses, want) {
+		t.Errorf("got statuses %q, want %q", statuses, want)
+	}
+	if segment := report.Segments[1]; segment.Original != "Merci, mon ami" || segment.Draft != "Thanks, friend" ||
+		segment.ReviewDiff != "Thanks, {+my +}friend" || segment.QA == nil || segment.QA.Score != 0.4 {
+		t.Errorf("got reviewed segment %+v", segment)
+	}
+	if segment := report.Segments[2]; segment.Error != "failed after 3 attempts" || segment.Attempts != 3 ||
+		!slices.Equal(segment.Violations, []string{"line width 40"}) {
+		t.Errorf("got failed segment %+v", segment)
+	}
+}
+
+func TestWriteReportCSV(t *testing.T) {
+	originals, translated := reportSegments()
+	path := filepath.Join(t.TempDir(), "report.CSV")
+	if err := writeReport(path, originals, translated, &Config{}); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 4 {
+		t.Fatalf("got %d records, want a header and 3 segments", len(records))
+	}
+	column := make(map[string]int)
+	for i, name := range records[0] {
+		column[name] = i
+	}
+	tests := []struct {
+		record int
+		column string
+		want   string
+	}{
+		{1, "status", "ok"},
+		{1, "qa_score", "0.900"},
+		{2, "original", "Merci, mon ami"},
+		{2, "review_diff", "Thanks, {+my +}friend"},
+		{3, "status", "failed"},
+		{3, "attempts", "3"},
+		{3, "error", "failed after 3 attempts"},
+		{3, "violations", "line width 40"},
+		{3, "qa_score", ""},
+	}
+	for _, test := range tests {
+		i, ok := column[test.column]
+		if !ok {
+			t.Errorf("no %s column in %q", test.column, records[0])
+			continue
+		}
+		if got := records[test.record][i]; got != test.want {
+			t.Errorf("record %d has %s %q, want %q", test.record, test.column, got, test.want)
+		}
+	}
+}
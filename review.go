@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// reviewTranslation sends the source segments and the draft translation to the review backend, and replaces
+// the lines it corrected. The previous text of a replaced line is kept in Draft. Lines the review failed to
+// return keep the draft.
+func reviewTranslation(segments []SrtSegment, drafts []SrtSegment, config *Config) []SrtSegment {
+	reviewConfig := *config.reviewBackend
+	reviewConfig.targetLang = config.targetLang
+
+	// Failed segments are not part of the draft
+	references := make([]SrtSegment, len(drafts))
+	for i, draft := range drafts {
+		references[i] = SrtSegment{ID: draft.ID, Time: draft.Time}
+		if draft.Err == nil {
+			references[i].Text = draft.Text
+		}
+	}
+
+	fmt.Printf("Reviewing the %s translation with %s\n", reviewConfig.targetLang, backendName(&reviewConfig))
+	reviewed := translateSrtSegmentsInBatches(segments, references, &reviewConfig)
+	if reviewed == nil {
+		fmt.Println("Review aborted, keeping the draft translation")
+		return drafts
+	}
+
+	results := make([]SrtSegment, len(drafts))
+	copy(results, drafts)
+	changed := 0
+	for i := range results {
+		if results[i].Err != nil || reviewed[i].Err != nil {
+			continue
+		}
+		if strings.TrimSpace(reviewed[i].Text) != strings.TrimSpace(results[i].Text) {
+			results[i].Draft = results[i].Text
+			results[i].Text = reviewed[i].Text
+			results[i].Backend += " + " + reviewed[i].Backend
+			results[i].Attempts += reviewed[i].Attempts
+			changed++
+		}
+	}
+	fmt.Printf("Review changed %d of %d segments\n", changed, len(results))
+
+	return results
+}
+
+// diffText describes the changes between two texts in a compact inline form, where removed parts are written
+// as [-removed-] and added parts as {+added+}. Texts with spaces are compared word by word, other texts
+// character by character.
+func diffText(before, after string) string {
+	words := strings.ContainsFunc(before, unicode.IsSpace) || strings.ContainsFunc(after, unicode.IsSpace)
+	a := diffTokens(before, words)
+	b := diffTokens(after, words)
+
+	// Longest common subsequence table
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var result, removed, added strings.Builder
+	flush := func() {
+		if removed.Len() > 0 {
+			result.WriteString("[-" + removed.String() + "-]")
+			removed.Reset()
+		}
+		if added.Len() > 0 {
+			result.WriteString("{+" + added.String() + "+}")
+			added.Reset()
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			flush()
+			result.WriteString(a[i])
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] >= lcs[i+1][j]):
+			added.WriteString(b[j])
+			j++
+		default:
+			removed.WriteString(a[i])
+			i++
+		}
+	}
+	flush()
+
+	return result.String()
+}
+
+// diffTokens splits a text into words and runs of spaces, or into characters.
+func diffTokens(s string, words bool) []string {
+	var tokens []string
+	if s == "" {
+		return nil
+	}
+	if !words {
+		for _, r := range s {
+			tokens = append(tokens, string(r))
+		}
+		return tokens
+	}
+
+	start := 0
+	for i, r := range s {
+		if i > start && unicode.IsSpace(r) != unicode.IsSpace([]rune(s[start:i])[0]) {
+			tokens = append(tokens, s[start:i])
+			start = i
+		}
+	}
+	return append(tokens, s[start:])
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// fakeTranslator answers every request with its segments, the text of each rewritten by a function of the
+// source text and of the reference text, if any.
+type fakeTranslator func(text, reference string) string
+
+func (f fakeTranslator) translate(request TranslationRequest, config *Config) (string, error) {
+	answer := make([]SrtSegment, len(request.Segments))
+	for i, segment := range request.Segments {
+		reference := ""
+		if i < len(request.References) {
+			reference = request.References[i].Text
+		}
+		answer[i] = SrtSegment{ID: segment.ID, Time: segment.Time, Text: f(segment.Text, reference)}
+	}
+	return formatSegments(answer), nil
+}
+
+// fakeBackend returns the config of a backend answering with the fake translator, without waiting between
+// requests.
+func fakeBackend(name string, translate fakeTranslator) *Config {
+	return &Config{
+		translator:           name,
+		maxTokens:            10000,
+		maxRequestsPerMinute: 60000,
+		maxRetries:           1,
+		limiter:              newRateLimiter(60000),
+		TranslatorImpl:       translate,
+	}
+}
+
+func TestDiffText(t *testing.T) {
+	tests := []struct {
+		name   string
+		before string
+		after  string
+		want   string
+	}{
+		{"identical", "the cat sat", "the cat sat", "the cat sat"},
+		{"word replaced", "the cat sat", "the dog sat", "the [-cat-]{+dog+} sat"},
+		{"word removed", "the big cat", "the cat", "the [-big -]cat"},
+		{"word added at the end", "the cat", "the cat sat", "the cat{+ sat+}"},
+		{"one side with spaces", "Thank", "Thank you", "Thank{+ you+}"},
+		{"words to empty", "the cat", "", "[-the cat-]"},
+		{"characters without spaces", "我爱你", "我喜欢你", "我[-爱-]{+喜欢+}你"},
+		{"from empty", "", "new", "{+new+}"},
+		{"to empty", "old", "", "[-old-]"},
+		{"both empty", "", "", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := diffText(test.before, test.after); got != test.want {
+				t.Errorf("diffText(%q, %q) = %q, want %q", test.before, test.after, got, test.want)
+			}
+		})
+	}
+}
+
+func TestReviewTranslation(t *testing.T) {
+	segments := segmentsOf(
+		"00:00:01,000 --> 00:00:02,000", "Bonjour",
+		"00:00:03,000 --> 00:00:04,000", "Merci",
+		"00:00:05,000 --> 00:00:06,000", "Au revoir",
+	)
+	drafts := []SrtSegment{
+		{ID: "1", Time: segments[0].Time, Text: "Hello", Backend: "draft", Attempts: 1},
+		{ID: "2", Time: segments[1].Time, Text: "Thank", Backend: "draft", Attempts: 1},
+		{ID: "3", Time: segments[2].Time, Text: "Au revoir", Backend: "draft", Attempts: 2, Err: errors.New("failed")},
+	}
+	config := Config{targetLang: "en", reviewBackend: fakeBackend("reviewer", func(text, draft string) string {
+		if draft == "Thank" {
+			return "Thank you"
+		}
+		return draft
+	})}
+
+	results := reviewTranslation(segments, drafts, &config)
+	if results[0].Text != "Hello" || results[0].Draft != "" || results[0].Backend != "draft" {
+		t.Errorf("unchanged segment got %+v", results[0])
+	}
+	if results[1].Text != "Thank you" || results[1].Draft != "Thank" || results[1].Backend != "draft + reviewer" || results[1].Attempts != 2 {
+		t.Errorf("corrected segment got %+v", results[1])
+	}
+	if results[2].Err == nil || results[2].Text != "Au revoir" || results[2].Draft != "" {
+		t.Errorf("failed segment got %+v", results[2])
+	}
+	if drafts[1].Text != "Thank" {
+		t.Errorf("the drafts were changed: %+v", drafts[1])
+	}
+	if !strings.Contains(diffText(results[1].Draft, results[1].Text), "{+ you+}") {
+		t.Errorf("got diff %q", diffText(results[1].Draft, results[1].Text))
+	}
+}
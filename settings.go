@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// configFileNames are looked up in the working directory, then in the stgo folder of the user config directory.
+var configFileNames = []string{"stgo.yaml", "stgo.yml"}
+
+// ConfigFile is the content of a configuration file. Settings are named after the command line flags, e.g.
+// "target_lang" or "systemprompt". Top-level settings apply to every run, and the settings of the selected
+// profile override them.
+type ConfigFile struct {
+	Profile  string                    `yaml:"profile"` // Profile used when --profile is not given
+	Settings map[string]any            `yaml:",inline"`
+	Profiles map[string]map[string]any `yaml:"profiles"`
+}
+
+// findConfigFile returns the configuration file to use: the given path, or the first one found in the working
+// directory or the user config directory. Returns an empty path if there is none.
+func findConfigFile(path string) (string, error) {
+	if path != "" {
+		if _, err := os.Stat(path); err != nil {
+			return "", err
+		}
+		return path, nil
+	}
+
+	dirs := []string{"."}
+	if configDir, err := os.UserConfigDir(); err == nil {
+		dirs = append(dirs, filepath.Join(configDir, "stgo"))
+	}
+	for _, dir := range dirs {
+		for _, name := range configFileNames {
+			candidate := filepath.Join(dir, name)
+			if _, err := os.Stat(candidate); err == nil {
+				return candidate, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// loadConfigFile reads a YAML configuration file.
+func loadConfigFile(path string) (*ConfigFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var configFile ConfigFile
+	if err := yaml.Unmarshal(data, &configFile); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &configFile, nil
+}
+
+// applySettings gives every flag not set on the command line its value from, in order of precedence, the
+// STGO_<FLAG> environment variable (e.g. STGO_APIKEY or STGO_TARGET_LANG), the selected profile and the top-level
+// settings of the configuration file. Flags set nowhere keep their default.
+func applySettings(cmd *cobra.Command, configPath string, profile string) error {
+	path, err := findConfigFile(configPath)
+	if err != nil {
+		return err
+	}
+	configFile := &ConfigFile{}
+	if path != "" {
+		if configFile, err = loadConfigFile(path); err != nil {
+			return err
+		}
+	}
+
+	if profile == "" {
+		profile = configFile.Profile
+	}
+	var profileSettings map[string]any
+	if profile != "" {
+		var ok bool
+		if profileSettings, ok = configFile.Profiles[profile]; !ok {
+			return fmt.Errorf("profile %q not found in %q", profile, path)
+		}
+	}
+
+	// Settings of other commands, such as the shift of timing, are valid but only apply to their command
+	known := knownFlags(cmd.Root())
+	for _, settings := range []map[string]any{configFile.Settings, profileSettings} {
+		for name := range settings {
+			if !known[name] {
+				return fmt.Errorf("unknown setting %q in %s", name, path)
+			}
+		}
+	}
+
+	flags := cmd.Flags()
+
+	var errs []error
+	flags.VisitAll(func(flag *pflag.Flag) {
+		if flag.Changed || flag.Name == "config" || flag.Name == "profile" {
+			return
+		}
+		if value, ok := os.LookupEnv("STGO_" + strings.ToUpper(strings.ReplaceAll(flag.Name, "-", "_"))); ok {
+			errs = append(errs, setFlag(flags, flag, value))
+		} else if value, ok := profileSettings[flag.Name]; ok {
+			errs = append(errs, setFlag(flags, flag, value))
+		} else if value, ok := configFile.Settings[flag.Name]; ok {
+			errs = append(errs, setFlag(flags, flag, value))
+		}
+	})
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// knownFlags returns the names of the flags of a command and all its subcommands.
+func knownFlags(cmd *cobra.Command) map[string]bool {
+	known := make(map[string]bool)
+	visit := func(flag *pflag.Flag) { known[flag.Name] = true }
+	cmd.PersistentFlags().VisitAll(visit)
+	cmd.Flags().VisitAll(visit)
+	for _, subcommand := range cmd.Commands() {
+		for name := range knownFlags(subcommand) {
+			known[name] = true
+		}
+	}
+	return known
+}
+
+// setFlag sets a flag from a setting. A list sets a repeatable flag once per item, and is joined with commas
+// for other flags.
+func setFlag(flags *pflag.FlagSet, flag *pflag.Flag, value any) error {
+	var values []string
+	if list, ok := value.([]any); ok {
+		for _, item := range list {
+			values = append(values, fmt.Sprint(item))
+		}
+	} else {
+		values = []string{fmt.Sprint(value)}
+	}
+	if !strings.HasSuffix(flag.Value.Type(), "Array") && !strings.HasSuffix(flag.Value.Type(), "Slice") {
+		values = []string{strings.Join(values, ",")}
+	}
+
+	for _, v := range values {
+		if err := flags.Set(flag.Name, v); err != nil {
+			return fmt.Errorf("invalid value %q for %s: %w", v, flag.Name, err)
+		}
+	}
+	return nil
+}
+
+// readSecretFile reads a secret such as an API key from a file, without the trailing newline.
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
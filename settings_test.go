@@ -0,0 +1,125 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+// settingsCommand returns a root command with a translate and a timing subcommand, parsed with args, and the
+// translate subcommand.
+func settingsCommand(t *testing.T, args []string) *cobra.Command {
+	root := &cobra.Command{Use: "stgo"}
+	root.PersistentFlags().String("target_lang", "zh", "")
+	root.PersistentFlags().String("config", "", "")
+	root.PersistentFlags().String("profile", "", "")
+	translate := &cobra.Command{Use: "translate"}
+	translate.Flags().Int("batch", 10, "")
+	timing := &cobra.Command{Use: "timing"}
+	timing.Flags().Float64("shift", 0, "")
+	root.AddCommand(translate, timing)
+	if err := translate.ParseFlags(args); err != nil {
+		t.Fatal(err)
+	}
+	return translate
+}
+
+// writeConfigFile writes a configuration file in a temporary folder and returns its path.
+func writeConfigFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "stgo.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// unsetEnv removes an environment variable for the duration of the test.
+func unsetEnv(t *testing.T, key string) {
+	t.Setenv(key, "")
+	os.Unsetenv(key)
+}
+
+func TestApplySettingsPrecedence(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		env      string // STGO_TARGET_LANG, unset if empty
+		profile  string // target_lang of the profile, if set
+		topLevel string // top-level target_lang, if set
+		want     string
+	}{
+		{name: "default", want: "zh"},
+		{name: "top-level", topLevel: "ja", want: "ja"},
+		{name: "profile over top-level", profile: "ko", topLevel: "ja", want: "ko"},
+		{name: "environment over profile", env: "fr", profile: "ko", topLevel: "ja", want: "fr"},
+		{name: "flag over environment", args: []string{"--target_lang=de"}, env: "fr", profile: "ko", topLevel: "ja", want: "de"},
+		{name: "flag over defaults only", args: []string{"--target_lang=de"}, want: "de"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.env != "" {
+				t.Setenv("STGO_TARGET_LANG", test.env)
+			} else {
+				unsetEnv(t, "STGO_TARGET_LANG")
+			}
+			content := "profiles:\n  p: {}\n"
+			if test.profile != "" {
+				content = "profiles:\n  p:\n    target_lang: " + test.profile + "\n"
+			}
+			if test.topLevel != "" {
+				content += "target_lang: " + test.topLevel + "\n"
+			}
+
+			cmd := settingsCommand(t, test.args)
+			if err := applySettings(cmd, writeConfigFile(t, content), "p"); err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := cmd.Flags().GetString("target_lang"); got != test.want {
+				t.Errorf("target_lang = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestApplySettingsKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		profile string
+		want    string // Expected target_lang when there is no error
+		err     string // Part of the expected error, if any
+	}{
+		{name: "unknown top-level setting", content: "nope: 1\n", err: `unknown setting "nope"`},
+		{name: "unknown profile setting", content: "profiles:\n  p:\n    nope: 1\n", profile: "p", err: `unknown setting "nope"`},
+		{name: "setting of another command", content: "shift: 2\n", want: "zh"},
+		{name: "invalid value", content: "batch: many\n", err: `invalid value "many" for batch`},
+		{name: "missing profile", content: "profiles:\n  p: {}\n", profile: "q", err: `profile "q" not found`},
+		{name: "profile selected by the file", content: "profile: p\nprofiles:\n  p:\n    target_lang: ko\n", want: "ko"},
+		{name: "list joined with commas", content: "target_lang: [en, fr]\n", want: "en,fr"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			unsetEnv(t, "STGO_TARGET_LANG")
+			unsetEnv(t, "STGO_BATCH")
+			cmd := settingsCommand(t, nil)
+			err := applySettings(cmd, writeConfigFile(t, test.content), test.profile)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got error %v, want one containing %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := cmd.Flags().GetString("target_lang"); got != test.want {
+				t.Errorf("target_lang = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// wordTimestampRegex matches the inline word timestamps of karaoke-style subtitles, such as <00:00:01.500>.
+var wordTimestampRegex = regexp.MustCompile(`<((?:\d+:)?\d{2}:\d{2}[.,]\d{3})>`)
+
+// splitLongSegments splits segments longer than maxDuration or maxChars into several timed segments, cutting
+// the text preferably after punctuation. The time of each cut comes from the word timestamps of the segment if
+// it has any, or is interpolated in proportion to the characters before it. Inline word timestamps are removed
+// from every segment. The IDs are renumbered to be sequential starting from 1.
+func splitLongSegments(segments []SrtSegment, maxDuration time.Duration, maxChars int) []SrtSegment {
+	results := make([]SrtSegment, 0, len(segments))
+	split := 0
+	for _, segment := range segments {
+		text, wordTimes := extractWordTimestamps(segment.Text)
+		segment.Text = text
+
+		start, end, err := parseTimeRange(segment.Time)
+		length := readableLength(text)
+		count := 1
+		if err == nil && end > start {
+			if maxDuration > 0 {
+				count = max(count, int(math.Ceil(float64(end-start)/float64(maxDuration))))
+			}
+			if maxChars > 0 {
+				count = max(count, (length+maxChars-1)/maxChars)
+			}
+		}
+		if count == 1 {
+			results = append(results, segment)
+			continue
+		}
+
+		segment.CueID = "" // The pieces cannot all keep the identifier of the cue
+		joined := joinLines(strings.Split(text, "\n"))
+		weights := make([]float64, count)
+		for k := range weights {
+			weights[k] = 1
+		}
+		pieces := splitTextProportionally(joined, weights)
+
+		// Each piece ends where the next one starts, after the characters of the previous pieces
+		position := 0
+		pieceStart := start
+		for k, piece := range pieces {
+			if piece == "" {
+				continue
+			}
+			position += readableLength(piece)
+			pieceEnd := end
+			if k < len(pieces)-1 && position < length {
+				pieceEnd = cutTime(start, end, position, length, wordTimes)
+			}
+			segment.Time = formatTimeRange(pieceStart, pieceEnd)
+			segment.Text = piece
+			results = append(results, segment)
+			pieceStart = pieceEnd
+		}
+		split++
+	}
+
+	for i := range results {
+		results[i].ID = fmt.Sprintf("%d", i+1)
+	}
+	if split > 0 {
+		fmt.Printf("Split %d long segments, %d segments in total\n", split, len(results))
+	}
+	return results
+}
+
+// cutTime returns the time of a cut made after the given number of readable characters. It is interpolated
+// between the nearest word timestamps around the cut, or between start and end if there are none.
+func cutTime(start, end time.Duration, position, length int, wordTimes map[int]time.Duration) time.Duration {
+	fromPosition, fromTime := 0, start
+	toPosition, toTime := length, end
+	for p, t := range wordTimes {
+		if t <= start || t >= end {
+			continue
+		}
+		if p <= position && p >= fromPosition && t >= fromTime {
+			fromPosition, fromTime = p, t
+		}
+		if p >= position && p <= toPosition && t <= toTime {
+			toPosition, toTime = p, t
+		}
+	}
+	if toPosition == fromPosition {
+		return fromTime
+	}
+	return fromTime + time.Duration(float64(toTime-fromTime)*float64(position-fromPosition)/float64(toPosition-fromPosition))
+}
+
+// extractWordTimestamps removes the inline word timestamps from a text, and returns the text and the time of
+// every timestamp by the number of readable characters before it.
+func extractWordTimestamps(text string) (string, map[int]time.Duration) {
+	if !wordTimestampRegex.MatchString(text) {
+		return text, nil
+	}
+
+	wordTimes := make(map[int]time.Duration)
+	var builder strings.Builder
+	last := 0
+	for _, match := range wordTimestampRegex.FindAllStringSubmatchIndex(text, -1) {
+		builder.WriteString(text[last:match[0]])
+		last = match[1]
+		if t, err := parseSrtTime(text[match[2]:match[3]]); err == nil {
+			wordTimes[readableLength(builder.String())] = t
+		}
+	}
+	builder.WriteString(text[last:])
+	return strings.TrimSpace(builder.String()), wordTimes
+}
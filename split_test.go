@@ -0,0 +1,132 @@
+package main
+
+import (
+	"maps"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSplitLongSegments(t *testing.T) {
+	tests := []struct {
+		name        string
+		segments    []SrtSegment
+		maxDuration time.Duration
+		maxChars    int
+		times       []string
+		texts       []string
+	}{
+		{
+			name: "short segments renumbered",
+			segments: []SrtSegment{
+				{ID: "5", Time: "00:00:01,000 --> 00:00:02,000", Text: "one"},
+				{ID: "9", Time: "00:00:03,000 --> 00:00:04,000", Text: "two"},
+			},
+			maxDuration: 3 * time.Second,
+			times:       []string{"00:00:01,000 --> 00:00:02,000", "00:00:03,000 --> 00:00:04,000"},
+			texts:       []string{"one", "two"},
+		},
+		{
+			name:        "too long, cut in proportion to the characters",
+			segments:    segmentsOf("00:00:00,000 --> 00:00:06,000", "one two\nthree four"),
+			maxDuration: 3 * time.Second,
+			times:       []string{"00:00:00,000 --> 00:00:02,400", "00:00:02,400 --> 00:00:06,000"},
+			texts:       []string{"one two", "three four"},
+		},
+		{
+			name:        "three pieces",
+			segments:    segmentsOf("00:00:00,000 --> 00:00:09,000", "aaa bbb ccc"),
+			maxDuration: 3 * time.Second,
+			times:       []string{"00:00:00,000 --> 00:00:03,000", "00:00:03,000 --> 00:00:06,000", "00:00:06,000 --> 00:00:09,000"},
+			texts:       []string{"aaa", "bbb", "ccc"},
+		},
+		{
+			name:        "cut at a word timestamp",
+			segments:    segmentsOf("00:00:00,000 --> 00:00:06,000", "<00:00:00.000>one <00:00:01.000>two <00:00:05.000>three four"),
+			maxDuration: 3 * time.Second,
+			times:       []string{"00:00:00,000 --> 00:00:05,000", "00:00:05,000 --> 00:00:06,000"},
+			texts:       []string{"one two", "three four"},
+		},
+		{
+			name:     "too many characters",
+			segments: segmentsOf("00:00:01,000 --> 00:00:04,000", "一二三四五六"),
+			maxChars: 3,
+			times:    []string{"00:00:01,000 --> 00:00:02,500", "00:00:02,500 --> 00:00:04,000"},
+			texts:    []string{"一二三", "四五六"},
+		},
+		{
+			name:        "unreadable time line left alone without timestamps",
+			segments:    segmentsOf("bad", "<00:00:01.000>one two three four"),
+			maxDuration: time.Second,
+			maxChars:    3,
+			times:       []string{"bad"},
+			texts:       []string{"one two three four"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			results := splitLongSegments(test.segments, test.maxDuration, test.maxChars)
+			var times, texts []string
+			for i, result := range results {
+				times = append(times, result.Time)
+				texts = append(texts, result.Text)
+				if want := strconv.Itoa(i + 1); result.ID != want {
+					t.Errorf("segment %d has ID %q, want %q", i, result.ID, want)
+				}
+			}
+			if !slices.Equal(times, test.times) || !slices.Equal(texts, test.texts) {
+				t.Errorf("got %q %q, want %q %q", times, texts, test.times, test.texts)
+			}
+		})
+	}
+}
+
+func TestExtractWordTimestamps(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		want  string
+		times map[int]time.Duration // By number of readable characters before the timestamp
+	}{
+		{"no timestamps", "Hello world", "Hello world", nil},
+		{"timestamps", "<00:00:01.500>Hello <00:00:02,000>world", "Hello world", map[int]time.Duration{0: 1500 * time.Millisecond, 5: 2 * time.Second}},
+		{"with hours", "Hello <01:00:00.250>world", "Hello world", map[int]time.Duration{5: time.Hour + 250*time.Millisecond}},
+		{"trailing timestamp", "一二<00:00:03.000>三<00:00:04.000>", "一二三", map[int]time.Duration{2: 3 * time.Second, 3: 4 * time.Second}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			text, times := extractWordTimestamps(test.text)
+			if text != test.want || !maps.Equal(times, test.times) {
+				t.Errorf("extractWordTimestamps(%q) = %q, %v, want %q, %v", test.text, text, times, test.want, test.times)
+			}
+		})
+	}
+}
+
+func TestCutTime(t *testing.T) {
+	const s = time.Second
+	tests := []struct {
+		name      string
+		position  int
+		wordTimes map[int]time.Duration
+		want      time.Duration
+	}{
+		{"interpolated without timestamps", 5, nil, 5 * s},
+		{"at a timestamp", 4, map[int]time.Duration{4: 7 * s}, 7 * s},
+		{"between timestamps", 5, map[int]time.Duration{4: 2 * s, 6: 4 * s}, 3 * s},
+		{"after the last timestamp", 7, map[int]time.Duration{4: 6 * s}, 8 * s},
+		{"timestamps outside the segment ignored", 5, map[int]time.Duration{2: 20 * s, 8: -s}, 5 * s},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Ten characters over ten seconds
+			if got := cutTime(0, 10*s, test.position, 10, test.wordTimes); got != test.want {
+				t.Errorf("cutTime at %d = %s, want %s", test.position, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+const (
+	syncResolution     = 50 * time.Millisecond // Size of the bins compared when aligning subtitles
+	syncLocalSearch    = 10 * time.Second      // How far a window may deviate from the global offset
+	syncMinWindowCues  = 5                     // Windows with fewer cues are not trusted to set their own offset
+	syncMinWindowScore = 0.3                   // Jaccard index a window must reach against the reference to set its own offset
+)
+
+// syncAnchor maps a time of the input to its offset.
+type syncAnchor struct {
+	at     time.Duration
+	offset time.Duration
+}
+
+// syncTimings finds the offset that best aligns the input subtitles with the reference subtitles, by comparing
+// when each of them shows a cue. With a window size, an offset is also searched for every window of the input
+// and the correction is interpolated linearly between the window centers, which absorbs drift such as a
+// framerate mismatch. Returns the transform and a description of the correction.
+func syncTimings(input, reference []SrtSegment, maxOffset time.Duration, window time.Duration) (timeTransform, []string, error) {
+	inputActivity, err := cueActivity(input)
+	if err != nil {
+		return nil, nil, fmt.Errorf("input: %w", err)
+	}
+	referenceActivity, err := cueActivity(reference)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reference: %w", err)
+	}
+
+	maxShift := int(maxOffset / syncResolution)
+	shift, score := bestShift(inputActivity, referenceActivity, 0, len(inputActivity), -maxShift, maxShift)
+	if score == 0 {
+		return nil, nil, fmt.Errorf("no overlap with the reference within %s", maxOffset)
+	}
+	globalOffset := time.Duration(shift) * syncResolution
+	description := []string{fmt.Sprintf("global offset %s", globalOffset)}
+
+	anchors := []syncAnchor{{0, globalOffset}}
+	if window > 0 {
+		anchors = nil
+		windowBins := int(window / syncResolution)
+		localShift := int(syncLocalSearch / syncResolution)
+		for lo := 0; lo < len(inputActivity); lo += windowBins {
+			hi := min(lo+windowBins, len(inputActivity))
+			cues := 0
+			for i := lo; i < hi; i++ {
+				if inputActivity[i] && (i == 0 || !inputActivity[i-1]) {
+					cues++
+				}
+			}
+			if cues < syncMinWindowCues {
+				continue
+			}
+			windowShift, windowScore := bestShift(inputActivity, referenceActivity, lo, hi, shift-localShift, shift+localShift)
+			if windowScore < syncMinWindowScore {
+				continue
+			}
+			anchor := syncAnchor{time.Duration(lo+hi) / 2 * syncResolution, time.Duration(windowShift) * syncResolution}
+			anchors = append(anchors, anchor)
+			description = append(description, fmt.Sprintf("offset %s around %s", anchor.offset, formatSrtTime(anchor.at)))
+		}
+		if len(anchors) == 0 {
+			anchors = []syncAnchor{{0, globalOffset}}
+			description = append(description, "no window could be aligned on its own, using the global offset")
+		}
+	}
+
+	return func(t time.Duration) time.Duration {
+		return t + interpolateOffset(anchors, t)
+	}, description, nil
+}
+
+// interpolateOffset returns the offset at time t, interpolated linearly between the anchors and constant
+// beyond the first and the last one.
+func interpolateOffset(anchors []syncAnchor, t time.Duration) time.Duration {
+	if t <= anchors[0].at {
+		return anchors[0].offset
+	}
+	for k := 1; k < len(anchors); k++ {
+		if t <= anchors[k].at {
+			a, b := anchors[k-1], anchors[k]
+			return a.offset + time.Duration(float64(b.offset-a.offset)*float64(t-a.at)/float64(b.at-a.at))
+		}
+	}
+	return anchors[len(anchors)-1].offset
+}
+
+// cueActivity returns, for every bin of syncResolution, whether a cue is shown.
+func cueActivity(segments []SrtSegment) ([]bool, error) {
+	var end time.Duration
+	ranges := make([][2]time.Duration, 0, len(segments))
+	for _, segment := range segments {
+		start, stop, err := parseTimeRange(segment.Time)
+		if err != nil {
+			return nil, fmt.Errorf("segment %s: %w", segment.ID, err)
+		}
+		ranges = append(ranges, [2]time.Duration{start, stop})
+		end = max(end, stop)
+	}
+
+	activity := make([]bool, int(end/syncResolution)+1)
+	for _, r := range ranges {
+		for i := int(r[0] / syncResolution); i < int(r[1]/syncResolution); i++ {
+			activity[i] = true
+		}
+	}
+	return activity, nil
+}
+
+// bestShift returns the shift, in bins between minShift and maxShift, that best aligns input[lo:hi] with the
+// reference, and its score. The score is the Jaccard index of the active bins of the window and of the reference
+// bins shifted into it, so cues shown by only one of them count against the shift: piling the input onto a long
+// reference cue does not score as well as matching the cues one by one. Ties go to the smallest shift in
+// absolute value.
+func bestShift(input, reference []bool, lo, hi, minShift, maxShift int) (int, float64) {
+	shifts := make([]int, 0, maxShift-minShift+1)
+	for s := minShift; s <= maxShift; s++ {
+		shifts = append(shifts, s)
+	}
+	slices.SortStableFunc(shifts, func(a, b int) int { return abs(a) - abs(b) })
+
+	best, bestShared, bestUnion := 0, 0, 1
+	for _, s := range shifts {
+		shared, union := 0, 0
+		for i := lo; i < hi; i++ {
+			j := i + s
+			inReference := j >= 0 && j < len(reference) && reference[j]
+			if input[i] && inReference {
+				shared++
+			}
+			if input[i] || inReference {
+				union++
+			}
+		}
+		// Compare the ratios without dividing, so that equal scores tie exactly
+		if union > 0 && shared*bestUnion > bestShared*union {
+			best, bestShared, bestUnion = s, shared, union
+		}
+	}
+	return best, float64(bestShared) / float64(bestUnion)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
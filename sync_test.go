@@ -0,0 +1,114 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// activity converts a pattern such as "..##." into bins, # being active.
+func activity(pattern string) []bool {
+	bins := make([]bool, len(pattern))
+	for i, c := range pattern {
+		bins[i] = c == '#'
+	}
+	return bins
+}
+
+func TestBestShift(t *testing.T) {
+	tests := []struct {
+		name               string
+		input, reference   string
+		lo, hi             int // hi of -1 is the end of the input
+		minShift, maxShift int
+		shift              int
+		score              float64
+	}{
+		{"aligned", ".##..#", ".##..#", 0, -1, -3, 3, 0, 1},
+		{"later in the reference", "##......", "...##...", 0, -1, -5, 5, 3, 1},
+		{"earlier in the reference", "....##..", ".##.....", 0, -1, -5, 5, -3, 1},
+		{"partial overlap", "###.....", "....###.", 0, -1, -2, 2, 2, 0.2},
+		{"offset at the upper boundary", "#.....", ".....#", 0, -1, -5, 5, 5, 1},
+		{"offset at the lower boundary", ".....#", "#.....", 0, -1, -5, 5, -5, 1},
+		{"offset beyond the boundary", "#.....", ".....#", 0, -1, -4, 4, 0, 0},
+		{"reference cue over input silence counts against the shift", "#...", "#.#.", 0, -1, -2, 2, 2, 1},
+		{"long reference cue does not outweigh matching cues", "#.#.#", "#.#.......##########", 0, -1, -12, 12, 0, 2.0 / 3},
+		{"tie goes to the smallest shift", "..#..", "..#.#", 0, -1, -2, 2, 0, 0.5},
+		{"tie between opposite shifts goes to the lowest", "..#..", ".#.#.", 0, -1, -1, 1, -1, 0.5},
+		{"only the window is compared", "#...#", "....#", 0, 1, -4, 4, 4, 1},
+		{"no overlap within the range", "...#", "#...", 0, -1, 1, 3, 0, 0},
+		{"empty input", "....", "##..", 0, -1, -2, 2, 0, 0},
+		{"empty window", "#...", "#...", 1, 1, -2, 2, 0, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hi := test.hi
+			if hi < 0 {
+				hi = len(test.input)
+			}
+			shift, score := bestShift(activity(test.input), activity(test.reference), test.lo, hi, test.minShift, test.maxShift)
+			if shift != test.shift || math.Abs(score-test.score) > 1e-9 {
+				t.Errorf("bestShift = %d, %v, want %d, %v", shift, score, test.shift, test.score)
+			}
+		})
+	}
+}
+
+func TestSyncTimingsGlobalOffset(t *testing.T) {
+	reference := []SrtSegment{
+		{ID: "1", Time: "00:00:01,000 --> 00:00:02,000"},
+		{ID: "2", Time: "00:00:03,500 --> 00:00:04,000"},
+		{ID: "3", Time: "00:00:07,000 --> 00:00:09,250"},
+	}
+
+	tests := []struct {
+		name      string
+		offset    time.Duration
+		maxOffset time.Duration
+		err       bool
+	}{
+		{"later", 1500 * time.Millisecond, 5 * time.Second, false},
+		{"earlier", -750 * time.Millisecond, 5 * time.Second, false},
+		{"at the boundary", 2 * time.Second, 2 * time.Second, false},
+		{"beyond the boundary without overlap", 20 * time.Second, 5 * time.Second, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			input := make([]SrtSegment, len(reference))
+			for i, segment := range reference {
+				start, end, _ := parseTimeRange(segment.Time)
+				input[i] = SrtSegment{ID: segment.ID, Time: formatTimeRange(start+test.offset, end+test.offset)}
+			}
+			transform, _, err := syncTimings(input, reference, test.maxOffset, 0)
+			if test.err {
+				if err == nil {
+					t.Error("got no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, segment := range input {
+				start, _, _ := parseTimeRange(segment.Time)
+				want, _, _ := parseTimeRange(reference[i].Time)
+				if got := transform(start); got != want {
+					t.Errorf("cue %d moved to %s, want %s", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSyncTimingsUnparsableTime(t *testing.T) {
+	input := []SrtSegment{{ID: "1", Time: "bad"}}
+	reference := []SrtSegment{{ID: "1", Time: "00:00:01,000 --> 00:00:02,000"}}
+	if _, _, err := syncTimings(input, reference, time.Second, 0); err == nil {
+		t.Error("got no error for an unparsable input time line")
+	}
+	if _, _, err := syncTimings(reference, input, time.Second, 0); err == nil {
+		t.Error("got no error for an unparsable reference time line")
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timeTransform maps a subtitle time to a new time.
+type timeTransform func(time.Duration) time.Duration
+
+// buildTimeTransform combines the timing operations of the config, applied in this order: framerate conversion,
+// linear stretch between two anchors, constant shift. Returns an error if no operation is set.
+func buildTimeTransform(config *Config) (timeTransform, error) {
+	var transforms []timeTransform
+
+	if config.fpsFrom != 0 || config.fpsTo != 0 {
+		if config.fpsFrom <= 0 || config.fpsTo <= 0 {
+			return nil, fmt.Errorf("--fps_from and --fps_to must both be positive")
+		}
+		// Frame n is shown at n/from seconds and must be shown at n/to seconds
+		ratio := config.fpsFrom / config.fpsTo
+		transforms = append(transforms, func(t time.Duration) time.Duration {
+			return time.Duration(float64(t) * ratio)
+		})
+	}
+
+	if len(config.timingAnchors) > 0 {
+		if len(config.timingAnchors) != 2 {
+			return nil, fmt.Errorf("--anchor must be given exactly twice")
+		}
+		var from, to [2]time.Duration
+		for k, anchor := range config.timingAnchors {
+			var err error
+			from[k], to[k], err = parseAnchor(anchor)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if from[0] == from[1] {
+			return nil, fmt.Errorf("the two anchors must be at different times")
+		}
+		scale := float64(to[1]-to[0]) / float64(from[1]-from[0])
+		transforms = append(transforms, func(t time.Duration) time.Duration {
+			return to[0] + time.Duration(float64(t-from[0])*scale)
+		})
+	}
+
+	if config.timingShift != "" {
+		shift, err := parseOffset(config.timingShift)
+		if err != nil {
+			return nil, err
+		}
+		transforms = append(transforms, func(t time.Duration) time.Duration {
+			return t + shift
+		})
+	}
+
+	if len(transforms) == 0 {
+		return nil, fmt.Errorf("no timing operation, use --shift, --anchor or --fps_from and --fps_to")
+	}
+	return func(t time.Duration) time.Duration {
+		for _, transform := range transforms {
+			t = transform(t)
+		}
+		return t
+	}, nil
+}
+
+// parseAnchor parses an anchor such as "00:01:00,000=00:01:02,500", mapping a current time to a new time.
+func parseAnchor(anchor string) (time.Duration, time.Duration, error) {
+	fromText, toText, ok := strings.Cut(anchor, "=")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid anchor %q, expected current=new", anchor)
+	}
+	from, err := parseSrtTime(fromText)
+	if err != nil {
+		return 0, 0, err
+	}
+	to, err := parseSrtTime(toText)
+	if err != nil {
+		return 0, 0, err
+	}
+	return from, to, nil
+}
+
+// parseOffset parses a signed offset given as a Go duration such as "-2.5s" or "1500ms", as a number of
+// seconds, or as a timestamp such as "-00:00:02,500".
+func parseOffset(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if d, err := time.ParseDuration(s); err == nil {
+		return d, nil
+	}
+	if seconds, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+	sign := time.Duration(1)
+	if rest, ok := strings.CutPrefix(s, "-"); ok {
+		sign, s = -1, rest
+	} else {
+		s = strings.TrimPrefix(s, "+")
+	}
+	d, err := parseSrtTime(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid offset %q", s)
+	}
+	return sign * d, nil
+}
+
+// retimeSegments applies the transform to the start and end of every segment. Times moved before zero are
+// clamped to zero.
+func retimeSegments(segments []SrtSegment, transform timeTransform) error {
+	for i := range segments {
+		start, end, err := parseTimeRange(segments[i].Time)
+		if err != nil {
+			return fmt.Errorf("segment %s: %w", segments[i].ID, err)
+		}
+		segments[i].Time = formatTimeRange(transform(start), transform(end))
+	}
+	return nil
+}
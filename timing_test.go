@@ -0,0 +1,81 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildTimeTransform(t *testing.T) {
+	const s = time.Second
+	tests := []struct {
+		name   string
+		config Config
+		at     time.Duration
+		want   time.Duration
+		err    string // Part of the expected error, if any
+	}{
+		{name: "shift as a duration", config: Config{timingShift: "2.5s"}, at: s, want: 3500 * time.Millisecond},
+		{name: "negative shift in milliseconds", config: Config{timingShift: "-1500ms"}, at: 2 * s, want: 500 * time.Millisecond},
+		{name: "shift in seconds", config: Config{timingShift: "+3"}, at: s, want: 4 * s},
+		{name: "shift as a timestamp", config: Config{timingShift: "-00:00:01,250"}, at: 2 * s, want: 750 * time.Millisecond},
+		{name: "invalid shift", config: Config{timingShift: "soon"}, err: "invalid offset"},
+		{
+			name:   "stretch between anchors",
+			config: Config{timingAnchors: []string{"00:01:00,000=00:01:02,000", "00:02:00,000=00:02:04,000"}},
+			at:     90 * s,
+			want:   93 * s,
+		},
+		{
+			name:   "stretch before the first anchor",
+			config: Config{timingAnchors: []string{"00:01:00,000=00:01:02,000", "00:02:00,000=00:02:04,000"}},
+			at:     0,
+			want:   0,
+		},
+		{name: "single anchor", config: Config{timingAnchors: []string{"00:01:00,000=00:01:02,000"}}, err: "exactly twice"},
+		{name: "anchors at the same time", config: Config{timingAnchors: []string{"00:01:00,000=00:01:02,000", "00:01:00,000=00:01:03,000"}}, err: "different times"},
+		{name: "anchor without new time", config: Config{timingAnchors: []string{"00:01:00,000", "00:02:00,000=00:02:04,000"}}, err: "expected current=new"},
+		{name: "framerate", config: Config{fpsFrom: 30, fpsTo: 25}, at: 10 * s, want: 12 * s},
+		{name: "framerate without target", config: Config{fpsFrom: 25}, err: "must both be positive"},
+		{name: "framerate then shift", config: Config{fpsFrom: 30, fpsTo: 25, timingShift: "1s"}, at: 10 * s, want: 13 * s},
+		{name: "no operation", config: Config{}, err: "no timing operation"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			transform, err := buildTimeTransform(&test.config)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got error %v, want one containing %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := transform(test.at).Round(time.Millisecond); got != test.want {
+				t.Errorf("transform(%s) = %s, want %s", test.at, got, test.want)
+			}
+		})
+	}
+}
+
+func TestRetimeSegments(t *testing.T) {
+	segments := segmentsOf(
+		"00:00:01,000 --> 00:00:03,000", "one",
+		"00:00:05,000 --> 00:00:06,500", "two")
+	shift := func(t time.Duration) time.Duration { return t - 2*time.Second }
+	if err := retimeSegments(segments, shift); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"00:00:00,000 --> 00:00:01,000", "00:00:03,000 --> 00:00:04,500"}
+	for i, segment := range segments {
+		if segment.Time != want[i] {
+			t.Errorf("segment %d has time %q, want %q", i, segment.Time, want[i])
+		}
+	}
+
+	if err := retimeSegments(segmentsOf("bad", "text"), shift); err == nil {
+		t.Error("got no error for an unparsable time line")
+	}
+}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"fmt"
+	"math"
 	"regexp"
+	"slices"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -14,25 +16,67 @@ import (
 // using the configured translator, and handles retries for failed translations. If singleLine mode
 // is enabled, failed batch translations will be retried individually. Returns the translated segments
 // with the same structure as the input, preserving original metadata.
+// Segments found in the translation memory are not sent again, and new translations are added to it.
 func translateSrtSegmentsInBatches(segments []SrtSegment, referenceSegments []SrtSegment, config *Config) []SrtSegment {
 	results := make([]SrtSegment, len(segments))
 	copy(results, segments) // Pre-populate with original data to simplify later assignments
 
+	// Look up the translation memory, only the remaining segments are translated.
+	// Translations refined with a reference are not interchangeable with plain ones, so they are not shared.
+	memory := config.memory
+	if config.referenceBackend != nil || config.referenceSrt != "" {
+		memory = nil
+	}
+	var pendingSegments, pendingReferences []SrtSegment
+	var pendingIndices []int
+	for i := range results {
+		results[i].Err = nil // Only translation errors are reported for the results
+		if text, ok := memory.lookup(segments[i].Text, config); ok {
+			results[i].Text = text
+			results[i].Backend = "memory"
+			continue
+		}
+		pendingIndices = append(pendingIndices, i)
+		pendingSegments = append(pendingSegments, segments[i])
+		if i < len(referenceSegments) {
+			pendingReferences = append(pendingReferences, referenceSegments[i])
+		}
+	}
+	if len(pendingIndices) < len(segments) {
+		fmt.Printf("%d of %d segments found in the translation memory\n", len(segments)-len(pendingIndices), len(segments))
+	}
+
+	translated := translateInBatches(pendingSegments, pendingReferences, config)
+	if translated == nil && len(pendingSegments) > 0 {
+		return nil
+	}
+	for n, i := range pendingIndices {
+		results[i] = translated[n]
+		if translated[n].Err == nil {
+			memory.store(segments[i].Text, translated[n].Text, config)
+		}
+	}
+
+	return results
+}
+
+// translateInBatches translates the segments in batches, see translateSrtSegmentsInBatches.
+func translateInBatches(segments []SrtSegment, referenceSegments []SrtSegment, config *Config) []SrtSegment {
+	results := make([]SrtSegment, len(segments))
+	copy(results, segments)
+	for i := range results {
+		results[i].Backend = backendName(config)
+	}
+
 	var completedSegments int32
 	var wg sync.WaitGroup
 	var mu sync.Mutex
 
-	// Setup rate limiting
-	maxRequestsPerMinute := config.maxRequestsPerMinute
-	ticker := time.NewTicker(time.Minute / time.Duration(maxRequestsPerMinute))
-	defer ticker.Stop()
-
-	// Limit concurrent requests
-	concurrencyLimiter := make(chan struct{}, maxRequestsPerMinute)
-	defer close(concurrencyLimiter)
+	// Rate limiting and concurrency are shared by all translations using the same backend
+	limiter := config.limiter
 
 	for startIndex := 0; startIndex < len(segments); {
-		combinedText, combinedReference, endIndex := combineText(segments, referenceSegments, startIndex, int(config.maxTokens))
+		combinedText, _, endIndex := combineText(segments, referenceSegments, startIndex, int(config.maxTokens))
 
 		if combinedText == "" {
 			fmt.Println("single segment too large to process: ", len(segments[startIndex].Text), "characters")
@@ -40,60 +84,56 @@ func translateSrtSegmentsInBatches(segments []SrtSegment, referenceSegments []Sr
 		}
 
 		wg.Add(1)
-		concurrencyLimiter <- struct{}{} // Acquire semaphore
+		limiter.acquire() // Acquire semaphore
 
 		// Process batch in a goroutine
-		go func(startIndex, endIndex int, combinedText, combinedReference string) {
+		go func(startIndex, endIndex int) {
 			defer wg.Done()
-			defer func() { <-concurrencyLimiter }() // Release semaphore
+			defer limiter.release() // Release semaphore
 
-			translatedSegments, err := translateSegments(startIndex, endIndex, combinedText, combinedReference, config, ticker)
+			batchReference := referenceSegments[min(startIndex, len(referenceSegments)):min(endIndex, len(referenceSegments))]
+			translatedSegments, err := translateSegments(segments[startIndex:endIndex], batchReference,
+				batchContext(segments, startIndex, endIndex, config.contextLines), config)
 
 			if err != nil {
 				// Batch failed: Retry each segment individually
-				if config.singleLine {
-					for i := startIndex; i < endIndex; i++ {
-						concurrencyLimiter <- struct{}{}
-
-						fmt.Printf("Retrying ID %s in single line mode\n", segments[i].ID)
-						translatedSingleLine, err := translateSegments(i, i+1, formatSegment(segments[i]), "", config, ticker)
-
-						mu.Lock()
-						if err != nil {
-							if results[i].Err == nil {
-								results[i].Err = err
-							}
-						} else {
-							results[i].Text = translatedSingleLine[0].Text
-						}
-						printProgress(segments[i], results[i], len(segments), &completedSegments)
-						mu.Unlock()
-
-						<-concurrencyLimiter
-					}
-				} else {
-					mu.Lock()
-					// If not in single line mode, mark all segments as failed
-					for i := startIndex; i < endIndex; i++ {
-						results[i].Err = err
-						printProgress(segments[i], results[i], len(segments), &completedSegments)
-					}
-					mu.Unlock()
-				}
-			} else { // Batch succeeded
+				var failed []int
+				var causes []error
 				mu.Lock()
 				for i := startIndex; i < endIndex; i++ {
-					idx := i - startIndex
-					if idx < len(translatedSegments) {
-						results[i].Text = translatedSegments[idx].Text
-					} else if results[i].Err == nil {
-						results[i].Err = fmt.Errorf("no translation available for this segment")
-					}
-					printProgress(segments[i], results[i], len(segments), &completedSegments)
+					results[i].Attempts += translatedSegments[i-startIndex].Attempts
+					failed = append(failed, i)
+					causes = append(causes, err)
 				}
 				mu.Unlock()
+				retrySegments(segments, referenceSegments, results, failed, causes, config, &mu, &completedSegments)
+				return
 			}
-		}(startIndex, endIndex, combinedText, combinedReference)
+
+			// Batch succeeded: mismatched segments and segments in the wrong language are sent back through the retry path
+			var failed []int
+			var causes []error
+			mu.Lock()
+			for i := startIndex; i < endIndex; i++ {
+				translated := translatedSegments[i-startIndex]
+				results[i].Attempts += translated.Attempts
+				err := translated.Err
+				if err == nil {
+					err = checkLanguage(segments[i].Text, translated.Text, config)
+				}
+				if err != nil {
+					fmt.Printf("ID %s: %v\n", segments[i].ID, err)
+					failed = append(failed, i)
+					causes = append(causes, err)
+					continue
+				}
+				results[i].Text = translated.Text
+				printProgress(segments[i], results[i], len(segments), &completedSegments)
+			}
+			mu.Unlock()
+
+			retrySegments(segments, referenceSegments, results, failed, causes, config, &mu, &completedSegments)
+		}(startIndex, endIndex)
 
 		startIndex = endIndex // Move to next batch
 	}
@@ -102,6 +142,161 @@ func translateSrtSegmentsInBatches(segments []SrtSegment, referenceSegments []Sr
 	return results
 }
 
+// retrySegments retries the given segments one by one in single line mode, each with its own reference so
+// that reviews and reference or pivot translations keep their prompt. If single line mode is disabled,
+// or a segment still fails, the segment keeps its original text and is marked with the error.
+// The caller must already hold a slot of the concurrency limiter.
+func retrySegments(segments, referenceSegments, results []SrtSegment, indices []int, causes []error, config *Config, mu *sync.Mutex, completedSegments *int32) {
+	for n, i := range indices {
+		err := causes[n]
+		var text string
+		var attempts int
+		if config.singleLine {
+			fmt.Printf("Retrying ID %s in single line mode\n", segments[i].ID)
+			var translatedSingleLine []SrtSegment
+			reference := referenceSegments[min(i, len(referenceSegments)):min(i+1, len(referenceSegments))]
+			translatedSingleLine, err = translateSegments(segments[i:i+1], reference, batchContext(segments, i, i+1, config.contextLines), config)
+			attempts = translatedSingleLine[0].Attempts
+			if err == nil {
+				text = translatedSingleLine[0].Text
+				err = checkLanguage(segments[i].Text, text, config)
+			}
+		}
+
+		mu.Lock()
+		results[i].Attempts += attempts
+		if err != nil {
+			if results[i].Err == nil {
+				results[i].Err = err
+			}
+		} else {
+			results[i].Text = text
+		}
+		printProgress(segments[i], results[i], len(segments), completedSegments)
+		mu.Unlock()
+	}
+}
+
+// RateLimiter paces the requests sent to a translation backend and limits how many run concurrently.
+// It is shared by every translation pass using the same backend, e.g. all target languages of a run.
+type RateLimiter struct {
+	ticker *time.Ticker
+	slots  chan struct{}
+}
+
+func newRateLimiter(maxRequestsPerMinute int) *RateLimiter {
+	return &RateLimiter{
+		ticker: time.NewTicker(time.Minute / time.Duration(maxRequestsPerMinute)),
+		slots:  make(chan struct{}, maxRequestsPerMinute),
+	}
+}
+
+// wait blocks until the next request is allowed.
+func (r *RateLimiter) wait() {
+	<-r.ticker.C
+}
+
+func (r *RateLimiter) acquire() {
+	r.slots <- struct{}{}
+}
+
+func (r *RateLimiter) release() {
+	<-r.slots
+}
+
+// minReferenceOverlap is the overlap needed for a reference cue to be attached to a segment, shorter overlaps
+// being mere jitter between cue boundaries.
+const minReferenceOverlap = 200 * time.Millisecond
+
+// alignReference aligns the reference segments to the segments by time instead of by position, so that a
+// reference with different segmentation, or preprocessing steps deleting and renumbering segments, do not feed
+// the wrong lines to the model. Every reference cue overlapping a segment's time range by at least
+// minReferenceOverlap (or half the cue, for shorter cues) is attached to it, several cues are merged, and a cue
+// overlapping several segments is split between them in proportion to the overlap. A cue overlapping no segment
+// that much is attached whole to the segment it overlaps most.
+// Segments whose times cannot be parsed fall back to matching the ID and time, then the start time.
+// Returns a slice with one reference per segment, carrying the segment's ID and time, with empty text where
+// nothing overlaps.
+func alignReference(segments []SrtSegment, referenceSegments []SrtSegment) []SrtSegment {
+	type timedCue struct {
+		start, end time.Duration
+		text       string
+	}
+	type timedSegment struct {
+		start, end time.Duration
+		ok         bool
+	}
+
+	var cues []timedCue
+	byIDAndTime := make(map[string]SrtSegment)
+	byStartTime := make(map[string]SrtSegment)
+	for _, reference := range referenceSegments {
+		byIDAndTime[strings.TrimSpace(reference.ID)+"|"+timeDigits(reference.Time)] = reference
+		if _, ok := byStartTime[startTimeDigits(reference.Time)]; !ok {
+			byStartTime[startTimeDigits(reference.Time)] = reference
+		}
+		if start, end, err := parseTimeRange(reference.Time); err == nil && end > start && strings.TrimSpace(reference.Text) != "" {
+			cues = append(cues, timedCue{start, end, reference.Text})
+		}
+	}
+
+	times := make([]timedSegment, len(segments))
+	for i, segment := range segments {
+		start, end, err := parseTimeRange(segment.Time)
+		times[i] = timedSegment{start, end, err == nil && end > start}
+	}
+
+	// Distribute every cue over the segments it overlaps
+	pieces := make([][]string, len(segments))
+	for _, cue := range cues {
+		// Boundary jitter is not an overlap, unless the cue is too short to tell
+		threshold := min(minReferenceOverlap, (cue.end-cue.start)/2)
+		var overlapping []int
+		var overlaps []float64
+		best, bestOverlap := -1, time.Duration(0)
+		for i, t := range times {
+			if !t.ok {
+				continue
+			}
+			overlap := min(cue.end, t.end) - max(cue.start, t.start)
+			if overlap > bestOverlap {
+				best, bestOverlap = i, overlap
+			}
+			if overlap > 0 && overlap >= threshold {
+				overlapping = append(overlapping, i)
+				overlaps = append(overlaps, float64(overlap))
+			}
+		}
+		if len(overlapping) == 0 && best >= 0 {
+			overlapping, overlaps = []int{best}, []float64{float64(bestOverlap)}
+		}
+		for n, part := range splitTextProportionally(cue.text, overlaps) {
+			if part != "" {
+				pieces[overlapping[n]] = append(pieces[overlapping[n]], part)
+			}
+		}
+	}
+
+	aligned := make([]SrtSegment, len(segments))
+	for i, segment := range segments {
+		aligned[i] = SrtSegment{ID: segment.ID, Time: segment.Time}
+		if times[i].ok {
+			aligned[i].Text = strings.Join(pieces[i], "\n")
+		} else if reference, ok := byIDAndTime[strings.TrimSpace(segment.ID)+"|"+timeDigits(segment.Time)]; ok {
+			aligned[i].Text = reference.Text
+		} else if reference, ok := byStartTime[startTimeDigits(segment.Time)]; ok {
+			aligned[i].Text = reference.Text
+		}
+	}
+	return aligned
+}
+
+// startTimeDigits returns the digits of the start time of a timecode.
+func startTimeDigits(s string) string {
+	start, _, _ := strings.Cut(s, "-->")
+	return timeDigits(start)
+}
+
 func combineText(segments []SrtSegment, referenceSegments []SrtSegment, startIndex int, maxChars int) (string, string, int) {
 	var combinedText, combinedReference string
 	endIndex := startIndex
@@ -113,7 +308,7 @@ func combineText(segments []SrtSegment, referenceSegments []SrtSegment, startInd
 
 		// Format corresponding reference segment if available
 		blockReference := ""
-		if endIndex < len(referenceSegments) {
+		if endIndex < len(referenceSegments) && referenceSegments[endIndex].Text != "" {
 			blockReference = formatSegment(referenceSegments[endIndex])
 		}
 
@@ -123,7 +318,7 @@ func combineText(segments []SrtSegment, referenceSegments []SrtSegment, startInd
 		if len(combinedText) > 0 {
 			separator = "\n\n" // Use double newline as separator
 		}
-		if len(combinedReference) > 0 {
+		if len(combinedReference) > 0 && blockReference != "" {
 			referenceSeparator = "\n\n"
 		}
 
@@ -143,26 +338,71 @@ func combineText(segments []SrtSegment, referenceSegments []SrtSegment, startInd
 	return combinedText, combinedReference, endIndex
 }
 
-func translateSegments(startIndex int, endIndex int, combinedText string, combinedReference string, config *Config, ticker *time.Ticker) ([]SrtSegment, error) {
+// translateSegments translates a batch of segments and validates the IDs and times of the response
+// against the originals. Segments that are matched correctly are kept, and only the missing or
+// mismatched ones are requested again on the next attempt. Returns the translations aligned with
+// the originals; segments that could not be matched after all attempts have Err set. An error is
+// returned only if no segment could be translated at all, in which case every segment has Err set.
+// The number of times each segment was requested is recorded in Attempts.
+func translateSegments(originals []SrtSegment, references []SrtSegment, context BatchContext, config *Config) ([]SrtSegment, error) {
+	results := make([]SrtSegment, len(originals))
+	errs := make([]error, len(originals))
+	attempts := make([]int, len(originals))
+	pending := make([]int, len(originals)) // Indices of the segments still waiting for a valid translation
+	for i := range pending {
+		pending[i] = i
+	}
+
+	var lastReason string
 	for retryCount := 1; retryCount <= config.maxRetries; retryCount++ {
-		<-ticker.C // Wait for the ticker on each attempt
+		config.limiter.wait() // Wait for the ticker on each attempt
+
+		// Only request the segments that are still pending
+		requested := make([]SrtSegment, 0, len(pending))
+		var requestedReferences []SrtSegment
+		for _, idx := range pending {
+			attempts[idx]++
+			requested = append(requested, originals[idx])
+			if idx < len(references) {
+				requestedReferences = append(requestedReferences, references[idx])
+			}
+		}
+		combinedText, combinedReference, _ := combineText(requested, requestedReferences, 0, math.MaxInt)
 
 		// Perform translation based on configured translator
-		translatedText, err := config.TranslatorImpl.translate(combinedText, combinedReference, config)
+		translatedText, err := config.TranslatorImpl.translate(TranslationRequest{
+			Text:       combinedText,
+			Reference:  combinedReference,
+			Segments:   requested,
+			References: requestedReferences,
+			Context:    context,
+		}, config)
 
 		// Check for translation issues
-		needRetry, translatedBlocks, retryReason := checkTranslationResult(translatedText, err, startIndex, endIndex)
+		needRetry, translatedBlocks, retryReason := checkTranslationResult(translatedText, err)
 
 		if !needRetry {
-			// Translation successful, extract segments
-			translatedSegments := make([]SrtSegment, 0, len(translatedBlocks))
-			for _, match := range translatedBlocks {
-				translatedSegments = append(translatedSegments, SrtSegment{
-					Text: match[3],
-				})
+			// Keep the correctly matched segments and retry the others
+			matched := matchTranslatedBlocks(requested, translatedBlocks)
+			var stillPending []int
+			for n, idx := range pending {
+				if matched[n].Err != nil {
+					errs[idx] = matched[n].Err
+					stillPending = append(stillPending, idx)
+				} else {
+					results[idx] = matched[n]
+				}
+			}
+			if len(stillPending) == 0 {
+				for i := range results {
+					results[i].Attempts = attempts[i]
+				}
+				return results, nil
 			}
-			return translatedSegments, nil
+			retryReason = fmt.Sprintf("%d of %d segments are missing or mismatched", len(stillPending), len(pending))
+			pending = stillPending
 		}
+		lastReason = retryReason
 
 		// Handle retry logic
 		if retryCount < config.maxRetries {
@@ -172,13 +412,30 @@ func translateSegments(startIndex int, endIndex int, combinedText string, combin
 		}
 	}
 
-	return nil, fmt.Errorf("failed to translate segments after %d attempts", config.maxRetries)
+	var err error
+	if len(pending) == len(originals) {
+		err = fmt.Errorf("failed to translate segments after %d attempts: %s", config.maxRetries, lastReason)
+	}
+
+	// Salvage the matched segments, the others are marked for the caller to retry
+	for _, idx := range pending {
+		results[idx] = originals[idx]
+		results[idx].Err = errs[idx]
+		if err != nil {
+			results[idx].Err = err
+		}
+	}
+	for i := range results {
+		results[i].Attempts = attempts[i]
+	}
+	return results, err
 }
 
-// checkTranslationResult validates the translation output
-func checkTranslationResult(translatedText string, err error, startIndex, endIndex int) (bool, [][]string, string) {
-	pattern := `(?m)^(\d+)\n(\d{2}.*?\d{2}.*?\d{2}.*?-+>.*?\d{2}.*?\d{2}.*?\d{3})\n(.*?)(?:\n\n|\z)`
-	re := regexp.MustCompile(pattern)
+// blockHeaderRegex matches the ID and timecode lines starting a translated block.
+var blockHeaderRegex = regexp.MustCompile(`(?m)^(\d+)\n(\d{2}.*?\d{2}.*?\d{2}.*?-+>.*?\d{2}.*?\d{2}.*?\d{3})$`)
+
+// checkTranslationResult validates the translation output and extracts the translated blocks
+func checkTranslationResult(translatedText string, err error) (bool, [][]string, string) {
 	translatedText = strings.Replace(translatedText, "\u200b", "", -1)
 	// Check for error response
 	if err != nil {
@@ -190,18 +447,90 @@ func checkTranslationResult(translatedText string, err error, startIndex, endInd
 		return true, nil, fmt.Sprintf("Error response received: %s", translatedText)
 	}
 
-	// Check segment count
-	translatedBlocks := re.FindAllStringSubmatch(translatedText, -1)
-	expectedCount := endIndex - startIndex
-	if len(translatedBlocks) != expectedCount {
-		return true, nil, fmt.Sprintf("Expected %d translated segments but got %d",
-			expectedCount, len(translatedBlocks))
+	translatedBlocks := splitTranslatedBlocks(translatedText)
+	if len(translatedBlocks) == 0 {
+		return true, nil, "No translated segments found in the response"
 	}
 
 	// Translation is valid
 	return false, translatedBlocks, ""
 }
 
+// splitTranslatedBlocks returns the ID, timecode and text of every block of a response. The text of a block
+// ends at the first blank line or at the header of the next block, so that a block with an empty text does
+// not swallow the block after it.
+func splitTranslatedBlocks(translatedText string) [][]string {
+	headers := blockHeaderRegex.FindAllStringSubmatchIndex(translatedText, -1)
+	blocks := make([][]string, 0, len(headers))
+	for k, header := range headers {
+		end := len(translatedText)
+		if k+1 < len(headers) {
+			end = headers[k+1][0]
+		}
+		text := strings.TrimPrefix(translatedText[header[1]:end], "\n")
+		if i := strings.Index(text, "\n\n"); i >= 0 {
+			text = text[:i]
+		}
+		text = strings.TrimSuffix(text, "\n")
+		blocks = append(blocks, []string{translatedText[header[0]:end],
+			translatedText[header[2]:header[3]], translatedText[header[4]:header[5]], text})
+	}
+	return blocks
+}
+
+// matchTranslatedBlocks maps the translated blocks to the original segments by ID and time instead of
+// by position, so that a dropped or duplicated block cannot shift the following translations.
+// Returns the translations aligned with the originals; segments without exactly one matching block have Err set.
+func matchTranslatedBlocks(originals []SrtSegment, translatedBlocks [][]string) []SrtSegment {
+	// Group the returned blocks by ID
+	blocksByID := make(map[string][][]string)
+	for _, match := range translatedBlocks {
+		id := strings.TrimSpace(match[1])
+		blocksByID[id] = append(blocksByID[id], match)
+	}
+
+	// Group the originals by ID, so that duplicated IDs in the source are matched in order
+	originalsByID := make(map[string][]int)
+	for i, original := range originals {
+		id := strings.TrimSpace(original.ID)
+		originalsByID[id] = append(originalsByID[id], i)
+	}
+
+	results := make([]SrtSegment, len(originals))
+	for i, original := range originals {
+		results[i] = SrtSegment{ID: original.ID, Time: original.Time}
+		id := strings.TrimSpace(original.ID)
+		blocks := blocksByID[id]
+		expected := originalsByID[id]
+
+		switch {
+		case len(blocks) == 0:
+			results[i].Err = fmt.Errorf("ID %s is missing from the response", original.ID)
+		case len(blocks) != len(expected):
+			results[i].Err = fmt.Errorf("ID %s appears %d times in the response", original.ID, len(blocks))
+		default:
+			block := blocks[slices.Index(expected, i)]
+			if timeDigits(block[2]) != timeDigits(original.Time) {
+				results[i].Err = fmt.Errorf("ID %s has time %s in the response, expected %s", original.ID, block[2], original.Time)
+			} else {
+				results[i].Text = strings.TrimSpace(block[3])
+			}
+		}
+	}
+
+	return results
+}
+
+// timeDigits keeps only the digits of a timecode, so that punctuation changed by the model does not matter.
+func timeDigits(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+}
+
 func printProgress(segment, result SrtSegment, len int, completedSegments *int32) {
 	fmt.Printf("%s\n%s\n%s\n%s\n",
 		segment.ID,
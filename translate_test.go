@@ -0,0 +1,274 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMatchTranslatedBlocks(t *testing.T) {
+	block := func(id, time, text string) []string {
+		return []string{id + "\n" + time + "\n" + text, id, time, text}
+	}
+	originals := []SrtSegment{
+		{ID: "1", Time: "00:00:01,000 --> 00:00:02,000", Text: "one"},
+		{ID: "2", Time: "00:00:02,000 --> 00:00:03,000", Text: "two"},
+		{ID: "3", Time: "00:00:03,000 --> 00:00:04,000", Text: "three"},
+	}
+
+	tests := []struct {
+		name      string
+		originals []SrtSegment
+		blocks    [][]string
+		texts     []string
+		errs      []bool
+	}{
+		{
+			name:      "in order",
+			originals: originals,
+			blocks: [][]string{
+				block("1", "00:00:01,000 --> 00:00:02,000", "一"),
+				block("2", "00:00:02,000 --> 00:00:03,000", "二"),
+				block("3", "00:00:03,000 --> 00:00:04,000", "三"),
+			},
+			texts: []string{"一", "二", "三"},
+			errs:  []bool{false, false, false},
+		},
+		{
+			name:      "out of order",
+			originals: originals,
+			blocks: [][]string{
+				block("3", "00:00:03,000 --> 00:00:04,000", "三"),
+				block("1", "00:00:01,000 --> 00:00:02,000", "一"),
+				block("2", "00:00:02,000 --> 00:00:03,000", "二"),
+			},
+			texts: []string{"一", "二", "三"},
+			errs:  []bool{false, false, false},
+		},
+		{
+			name:      "dropped block does not shift the following ones",
+			originals: originals,
+			blocks: [][]string{
+				block("1", "00:00:01,000 --> 00:00:02,000", "一"),
+				block("3", "00:00:03,000 --> 00:00:04,000", "三"),
+			},
+			texts: []string{"一", "", "三"},
+			errs:  []bool{false, true, false},
+		},
+		{
+			name:      "duplicated block",
+			originals: originals,
+			blocks: [][]string{
+				block("1", "00:00:01,000 --> 00:00:02,000", "一"),
+				block("2", "00:00:02,000 --> 00:00:03,000", "二"),
+				block("2", "00:00:02,000 --> 00:00:03,000", "二"),
+				block("3", "00:00:03,000 --> 00:00:04,000", "三"),
+			},
+			texts: []string{"一", "", "三"},
+			errs:  []bool{false, true, false},
+		},
+		{
+			name:      "changed time",
+			originals: originals,
+			blocks: [][]string{
+				block("1", "00:00:01,000 --> 00:00:02,000", "一"),
+				block("2", "00:00:02,500 --> 00:00:03,000", "二"),
+				block("3", "00:00:03,000 --> 00:00:04,000", "三"),
+			},
+			texts: []string{"一", "", "三"},
+			errs:  []bool{false, true, false},
+		},
+		{
+			name:      "time punctuation changed by the model",
+			originals: originals[:1],
+			blocks:    [][]string{block(" 1 ", "00:00:01.000 -> 00:00:02.000", " 一 ")},
+			texts:     []string{"一"},
+			errs:      []bool{false},
+		},
+		{
+			name: "duplicated IDs in the source are matched in order",
+			originals: []SrtSegment{
+				{ID: "1", Time: "00:00:01,000 --> 00:00:02,000"},
+				{ID: "1", Time: "00:00:02,000 --> 00:00:03,000"},
+			},
+			blocks: [][]string{
+				block("1", "00:00:01,000 --> 00:00:02,000", "一"),
+				block("1", "00:00:02,000 --> 00:00:03,000", "二"),
+			},
+			texts: []string{"一", "二"},
+			errs:  []bool{false, false},
+		},
+		{
+			name:      "empty text",
+			originals: originals[:1],
+			blocks:    [][]string{block("1", "00:00:01,000 --> 00:00:02,000", "")},
+			texts:     []string{""},
+			errs:      []bool{false},
+		},
+		{
+			name:      "empty response",
+			originals: originals[:2],
+			texts:     []string{"", ""},
+			errs:      []bool{true, true},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			results := matchTranslatedBlocks(test.originals, test.blocks)
+			if len(results) != len(test.originals) {
+				t.Fatalf("got %d results, want %d", len(results), len(test.originals))
+			}
+			for i, result := range results {
+				if result.ID != test.originals[i].ID || result.Time != test.originals[i].Time {
+					t.Errorf("result %d has ID %q and time %q, want those of the original", i, result.ID, result.Time)
+				}
+				if result.Text != test.texts[i] {
+					t.Errorf("result %d has text %q, want %q", i, result.Text, test.texts[i])
+				}
+				if (result.Err != nil) != test.errs[i] {
+					t.Errorf("result %d has error %v, want error %v", i, result.Err, test.errs[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCheckTranslationResult(t *testing.T) {
+	const t1, t2, t3 = "00:00:01,000 --> 00:00:02,000", "00:00:02,000 --> 00:00:03,000", "00:00:03,000 --> 00:00:04,000"
+	tests := []struct {
+		name     string
+		response string
+		ids      []string
+		texts    []string
+		retry    bool
+	}{
+		{"blocks", "1\n" + t1 + "\n一\n\n2\n" + t2 + "\n二\n", []string{"1", "2"}, []string{"一", "二"}, false},
+		{"multi-line text", "1\n" + t1 + "\n一\n行\n\n2\n" + t2 + "\n二", []string{"1", "2"}, []string{"一\n行", "二"}, false},
+		{"empty text followed by a block", "1\n" + t1 + "\n\n2\n" + t2 + "\n二", []string{"1", "2"}, []string{"", "二"}, false},
+		{"empty text at the end", "1\n" + t1 + "\n一\n\n2\n" + t2 + "\n", []string{"1", "2"}, []string{"一", ""}, false},
+		{"no blank line between blocks", "1\n" + t1 + "\n一\n2\n" + t2 + "\n二\n3\n" + t3 + "\n三", []string{"1", "2", "3"}, []string{"一", "二", "三"}, false},
+		{"commentary after the last block", "1\n" + t1 + "\n一\n\nHope this helps!", []string{"1"}, []string{"一"}, false},
+		{"zero-width spaces removed", "1\u200b\n" + t1 + "\n一", []string{"1"}, []string{"一"}, false},
+		{"no block", "Sorry, I cannot translate this.", nil, nil, true},
+		{"error tag", "[STGERROR] too long", nil, nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			retry, blocks, _ := checkTranslationResult(test.response, nil)
+			if retry != test.retry {
+				t.Fatalf("got retry %v, want %v", retry, test.retry)
+			}
+			var ids, texts []string
+			for _, block := range blocks {
+				ids = append(ids, block[1])
+				texts = append(texts, block[3])
+			}
+			if !slices.Equal(ids, test.ids) || !slices.Equal(texts, test.texts) {
+				t.Errorf("got IDs %q with texts %q, want %q with %q", ids, texts, test.ids, test.texts)
+			}
+		})
+	}
+}
+
+func TestAlignReference(t *testing.T) {
+	segments := []SrtSegment{
+		{ID: "1", Time: "00:00:01,000 --> 00:00:02,000"},
+		{ID: "2", Time: "00:00:02,000 --> 00:00:03,000"},
+	}
+
+	tests := []struct {
+		name      string
+		segments  []SrtSegment
+		reference []SrtSegment
+		texts     []string
+	}{
+		{
+			name:     "same segmentation",
+			segments: segments,
+			reference: []SrtSegment{
+				{ID: "1", Time: "00:00:01,000 --> 00:00:02,000", Text: "one"},
+				{ID: "2", Time: "00:00:02,000 --> 00:00:03,000", Text: "two"},
+			},
+			texts: []string{"one", "two"},
+		},
+		{
+			name:      "cue split in proportion to the overlap",
+			segments:  segments,
+			reference: []SrtSegment{{ID: "1", Time: "00:00:01,000 --> 00:00:03,000", Text: "first half second half"}},
+			texts:     []string{"first half", "second half"},
+		},
+		{
+			name:     "cues merged into one segment",
+			segments: segments[:1],
+			reference: []SrtSegment{
+				{ID: "1", Time: "00:00:01,000 --> 00:00:01,500", Text: "one"},
+				{ID: "2", Time: "00:00:01,500 --> 00:00:02,000", Text: "two"},
+			},
+			texts: []string{"one\ntwo"},
+		},
+		{
+			name:     "boundary jitter is not an overlap",
+			segments: segments,
+			reference: []SrtSegment{
+				{ID: "1", Time: "00:00:01,000 --> 00:00:02,150", Text: "one two"},
+				{ID: "2", Time: "00:00:02,150 --> 00:00:03,000", Text: "three"},
+			},
+			texts: []string{"one two", "three"},
+		},
+		{
+			name:      "cue barely overlapping is attached whole where it overlaps most",
+			segments:  segments,
+			reference: []SrtSegment{{ID: "1", Time: "00:00:00,000 --> 00:00:01,100", Text: "one two"}},
+			texts:     []string{"one two", ""},
+		},
+		{
+			name:      "short cue across a boundary",
+			segments:  segments,
+			reference: []SrtSegment{{ID: "1", Time: "00:00:01,800 --> 00:00:02,200", Text: "one two"}},
+			texts:     []string{"one", "two"},
+		},
+		{
+			name:      "cue overlapping nothing",
+			segments:  segments,
+			reference: []SrtSegment{{ID: "1", Time: "00:00:05,000 --> 00:00:06,000", Text: "far"}},
+			texts:     []string{"", ""},
+		},
+		{
+			name:      "empty reference text",
+			segments:  segments,
+			reference: []SrtSegment{{ID: "1", Time: "00:00:01,000 --> 00:00:03,000", Text: " "}},
+			texts:     []string{"", ""},
+		},
+		{
+			name: "unparsable segment time falls back to ID and time, then start time",
+			segments: []SrtSegment{
+				{ID: "1", Time: "00:00:01,000 --> bad"},
+				{ID: "9", Time: "00:00:02,000 -> ?"},
+				{ID: "3", Time: "garbage"},
+			},
+			reference: []SrtSegment{
+				{ID: "1", Time: "00:00:01,000 --> bad", Text: "one"},
+				{ID: "2", Time: "00:00:02,000 --> 00:00:03,000", Text: "two"},
+			},
+			texts: []string{"one", "two", ""},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			aligned := alignReference(test.segments, test.reference)
+			if len(aligned) != len(test.segments) {
+				t.Fatalf("got %d references, want %d", len(aligned), len(test.segments))
+			}
+			for i, reference := range aligned {
+				if reference.ID != test.segments[i].ID || reference.Time != test.segments[i].Time {
+					t.Errorf("reference %d has ID %q and time %q, want those of the segment", i, reference.ID, reference.Time)
+				}
+				if reference.Text != test.texts[i] {
+					t.Errorf("reference %d has text %q, want %q", i, reference.Text, test.texts[i])
+				}
+			}
+		})
+	}
+}
@@ -13,7 +13,7 @@ import (
 )
 
 type Translator interface {
-	translate(originalText string, referenceTranslation string, config *Config) (string, error)
+	translate(request TranslationRequest, config *Config) (string, error)
 }
 
 type GoogleTranslator struct {
@@ -30,16 +30,18 @@ type OpenAIResponse struct {
 			Content string `json:"content"`
 		} `json:"message"`
 	} `json:"choices"`
+	Usage struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
 }
 
 // translate sends a request to OpenAI API to translate text
 // It handles both simple translation and translation with reference
-func (o *OpenAITranslator) translate(originalText string, referenceTranslation string, config *Config) (string, error) {
-	// Prepare content based on whether reference translation is provided
-	content := strings.Replace(config.userPrompt, "<ot>", originalText, 1)
-	if referenceTranslation != "" {
-		content = strings.Replace(config.userPrompt3, "<ot>", originalText, 1)
-		content = strings.Replace(content, "<rt>", referenceTranslation, 1)
+func (o *OpenAITranslator) translate(request TranslationRequest, config *Config) (string, error) {
+	messages, err := buildMessages(request, config)
+	if err != nil {
+		return "", err
 	}
 
 	// Prepare request payload
@@ -48,10 +50,7 @@ func (o *OpenAITranslator) translate(originalText string, referenceTranslation s
 		"temperature": config.temperature,
 		"top_p":       config.topP,
 		"max_tokens":  config.maxTokens,
-		"messages": []map[string]string{
-			{"role": "system", "content": config.systemPrompt},
-			{"role": "user", "content": content},
-		},
+		"messages":    messages,
 	}
 
 	requestBody, err := json.Marshal(payload)
@@ -88,22 +87,58 @@ func (o *OpenAITranslator) translate(originalText string, referenceTranslation s
 	if err := json.Unmarshal(body, &response); err != nil {
 		return "", fmt.Errorf("failed to parse response: %w", err)
 	}
+	config.usage.add(response.Usage.PromptTokens, response.Usage.CompletionTokens)
 
 	// Handle empty response
 	if len(response.Choices) == 0 || response.Choices[0].Message.Content == "" {
-		return "[STGERROR]" + originalText, nil
+		return "[STGERROR]" + request.Text, nil
 	}
 
 	return strings.TrimSpace(response.Choices[0].Message.Content), nil
 }
 
-func (g *GoogleTranslator) translate(originalText string, referenceTranslation string, config *Config) (string, error) {
+// backendName describes the configured translator, including the model if any.
+func backendName(config *Config) string {
+	if config.modelName != "" {
+		return config.translator + ":" + config.modelName
+	}
+	return config.translator
+}
+
+// buildUserPrompt fills the user prompt template with the languages, the glossary entries found in the batch,
+// the title, the notes and the text to be translated, switching to the reference prompt when a reference
+// translation is provided. When translating through a pivot language, the text is in the pivot language and
+// the reference is the original text. Placeholders are replaced in a single pass, so text containing a
+// placeholder is left as is.
+func buildUserPrompt(request TranslationRequest, config *Config) string {
+	template := config.userPrompt
+	if request.Reference != "" {
+		template = config.userPrompt3
+		if config.pivotLang != "" {
+			template = config.userPromptPivot
+		}
+	}
+	return strings.NewReplacer(
+		"<source_lang>", config.sourceLang,
+		"<target_lang>", config.targetLang,
+		"<pivot_lang>", config.pivotLang,
+		"<source_lang_name>", languageName(config.sourceLang),
+		"<target_lang_name>", languageName(config.targetLang),
+		"<glossary>", formatGlossary(glossaryHits(config.glossary, request.Text)),
+		"<title>", config.title,
+		"<notes>", config.notes,
+		"<ot>", request.Text,
+		"<rt>", request.Reference,
+	).Replace(template)
+}
+
+func (g *GoogleTranslator) translate(request TranslationRequest, config *Config) (string, error) {
 	// Create Google Translate client with proxy from environment
 	t := googletrans.New(googletrans.Config{
 		Proxy: os.Getenv("http_proxy"),
 	})
 
-	result, err := t.Translate(originalText, "auto", config.targetLang)
+	result, err := t.Translate(request.Text, "auto", config.targetLang)
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// UsageCounter adds up the requests and tokens reported by the OpenAI compatible APIs. It is shared by all
+// files, target languages and backends of a run. A nil counter is valid and counts nothing.
+type UsageCounter struct {
+	requests     atomic.Int64
+	inputTokens  atomic.Int64
+	outputTokens atomic.Int64
+}
+
+// add records a request and the tokens it used.
+func (u *UsageCounter) add(inputTokens, outputTokens int) {
+	if u == nil {
+		return
+	}
+	u.requests.Add(1)
+	u.inputTokens.Add(int64(inputTokens))
+	u.outputTokens.Add(int64(outputTokens))
+}
+
+// describe describes the usage, with its cost under the prices of the config if they are set.
+func (u *UsageCounter) describe(config *Config) string {
+	description := fmt.Sprintf("%d requests, %d input tokens, %d output tokens",
+		u.requests.Load(), u.inputTokens.Load(), u.outputTokens.Load())
+	if config.inputPrice > 0 || config.outputPrice > 0 {
+		cost := float64(u.inputTokens.Load())/1e6*config.inputPrice + float64(u.outputTokens.Load())/1e6*config.outputPrice
+		description += fmt.Sprintf(", cost %.4f", cost)
+	}
+	return description
+}
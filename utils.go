@@ -3,9 +3,12 @@ package main
 import (
 	"bufio"
 	"fmt"
+	"math"
 	"os"
+	"strconv"
 	"strings"
 	"time"
+	"unicode"
 	"unicode/utf8"
 
 	"github.com/dlclark/regexp2"
@@ -24,9 +27,14 @@ func readSrtFile(filepath string) ([]SrtSegment, error) {
 	var segment SrtSegment
 	var textLines []string // Multiple lines of text in one segment
 
-	for scanner.Scan() {
-		line := scanner.Text()
-		if line == "" { // End of a segment
+	for first := true; scanner.Scan(); first = false {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if first {
+			line = strings.TrimPrefix(line, "\uFEFF")
+		}
+		if line == "" && segment.ID == "" { // Extra blank line between segments
+			continue
+		} else if line == "" { // End of a segment
 			segment.Text = strings.Join(textLines, "\n")
 			results = append(results, segment)
 			segment = SrtSegment{}
@@ -70,6 +78,40 @@ func saveSrtFile(translatedSegments []SrtSegment, originalSegments []SrtSegment,
 	return nil
 }
 
+// applyFailurePolicy rewrites the text of segments that failed to translate:
+// "keep" keeps the original text, "marker" prefixes it with the marker and "empty" clears it.
+func applyFailurePolicy(segments []SrtSegment, policy string, marker string) error {
+	switch policy {
+	case "keep":
+		return nil
+	case "marker", "empty":
+	default:
+		return fmt.Errorf("unknown failure policy: %s", policy)
+	}
+
+	for i := range segments {
+		if segments[i].Err == nil {
+			continue
+		}
+		if policy == "marker" {
+			segments[i].Text = marker + " " + segments[i].Text
+		} else {
+			segments[i].Text = ""
+		}
+	}
+	return nil
+}
+
+func countFailedSegments(segments []SrtSegment) int {
+	failed := 0
+	for _, segment := range segments {
+		if segment.Err != nil {
+			failed++
+		}
+	}
+	return failed
+}
+
 func checkError(err error) {
 	if err != nil {
 		fmt.Println("Error :", err)
@@ -177,14 +219,20 @@ func extendSegments(segments []SrtSegment) []SrtSegment {
 
 	for i := 0; i < len(segments); i++ {
 		times := strings.Split(segments[i].Time, " --> ")
+		if len(times) != 2 {
+			segments[i].Err = fmt.Errorf("invalid time line: %q", segments[i].Time)
+			continue
+		}
 
 		startTime, err := time.Parse(timeLayout, times[0])
 		if err != nil {
 			segments[i].Err = err
+			continue
 		}
 		endTime, err := time.Parse(timeLayout, times[1])
 		if err != nil {
 			segments[i].Err = err
+			continue
 		}
 
 		duration := endTime.Sub(startTime)
@@ -199,6 +247,7 @@ func extendSegments(segments []SrtSegment) []SrtSegment {
 				extendedDuration = maxDuration
 			}
 
+			originalEndTime := endTime
 			endTime = startTime.Add(extendedDuration)
 			if i+1 < len(segments) {
 				nextSegmentStartTime, _ := time.Parse(timeLayout, strings.Split(segments[i+1].Time, " --> ")[0])
@@ -206,6 +255,10 @@ func extendSegments(segments []SrtSegment) []SrtSegment {
 					endTime = nextSegmentStartTime.Add(-50 * time.Millisecond)
 				}
 			}
+			// Never shorten the segment, let alone end it before it starts
+			if endTime.Before(originalEndTime) {
+				endTime = originalEndTime
+			}
 			segments[i].Time = fmt.Sprintf("%s --> %s", startTime.Format(timeLayout), endTime.Format(timeLayout))
 		}
 	}
@@ -213,10 +266,139 @@ func extendSegments(segments []SrtSegment) []SrtSegment {
 	return segments
 }
 
-// replacePlaceholders replaces all occurrences of keys in the input string with their associated values.
-func replacePlaceholders(input string, replacements map[string]string) string {
-	for placeholder, value := range replacements {
-		input = strings.ReplaceAll(input, placeholder, value)
+// parseSrtTime parses a timestamp such as "00:01:02,345" into a duration. A dot is accepted as the
+// decimal separator and the hours may be omitted, as in WebVTT.
+func parseSrtTime(s string) (time.Duration, error) {
+	s = strings.TrimSpace(strings.Replace(s, ",", ".", 1))
+	clock, fraction, _ := strings.Cut(s, ".")
+
+	parts := strings.Split(clock, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("invalid timestamp: %q", s)
+	}
+	var total time.Duration
+	for _, part := range parts {
+		value, err := strconv.Atoi(part)
+		if err != nil || value < 0 {
+			return 0, fmt.Errorf("invalid timestamp: %q", s)
+		}
+		total = total*60 + time.Duration(value)*time.Second
+	}
+
+	if fraction != "" {
+		// Pad or cut the fraction to milliseconds
+		fraction = (fraction + "000")[:3]
+		ms, err := strconv.Atoi(fraction)
+		if err != nil {
+			return 0, fmt.Errorf("invalid timestamp: %q", s)
+		}
+		total += time.Duration(ms) * time.Millisecond
+	}
+	return total, nil
+}
+
+// formatSrtTime formats a duration as an SRT timestamp such as "00:01:02,345". Negative durations are clamped to zero.
+func formatSrtTime(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d,%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// parseTimeRange parses the time line of a segment, such as "00:00:01,000 --> 00:00:02,500".
+func parseTimeRange(timeLine string) (time.Duration, time.Duration, error) {
+	startText, endText, ok := strings.Cut(timeLine, "-->")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid time line: %q", timeLine)
+	}
+	start, err := parseSrtTime(startText)
+	if err != nil {
+		return 0, 0, err
+	}
+	// WebVTT cue settings may follow the end time
+	endFields := strings.Fields(endText)
+	if len(endFields) == 0 {
+		return 0, 0, fmt.Errorf("invalid time line: %q", timeLine)
+	}
+	end, err := parseSrtTime(endFields[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	return start, end, nil
+}
+
+// formatTimeRange formats the time line of a segment.
+func formatTimeRange(start, end time.Duration) string {
+	return formatSrtTime(start) + " --> " + formatSrtTime(end)
+}
+
+// splitTextProportionally splits a text into as many parts as there are weights, with lengths proportional
+// to the weights. Text with spaces is cut at word boundaries, other text between characters. Cuts right after
+// punctuation are preferred when they are close to the ideal position.
+func splitTextProportionally(text string, weights []float64) []string {
+	parts := make([]string, len(weights))
+	if len(weights) == 0 {
+		return parts
+	}
+	runes := []rune(strings.TrimSpace(text))
+	var totalWeight float64
+	for _, weight := range weights {
+		totalWeight += weight
+	}
+	if len(weights) == 1 || len(runes) == 0 || totalWeight <= 0 {
+		parts[0] = string(runes)
+		return parts
+	}
+
+	hasSpaces := strings.ContainsFunc(string(runes), unicode.IsSpace)
+	canCut := func(i int) bool {
+		if hasSpaces {
+			return unicode.IsSpace(runes[i-1]) && !unicode.IsSpace(runes[i])
+		}
+		// Do not start a part with punctuation
+		return !unicode.IsPunct(runes[i])
+	}
+
+	bonus := float64(len(runes)) / float64(3*len(weights))
+	previous := 0
+	var cumulative float64
+	k := 0
+	for ; k < len(weights)-1; k++ {
+		cumulative += weights[k]
+		ideal := cumulative / totalWeight * float64(len(runes))
+
+		best, bestScore := -1, math.MaxFloat64
+		for i := previous + 1; i < len(runes); i++ {
+			if !canCut(i) {
+				continue
+			}
+			score := math.Abs(float64(i) - ideal)
+			if unicode.IsPunct(runes[i-1]) || (hasSpaces && i > 1 && unicode.IsPunct(runes[i-2])) {
+				score -= bonus
+			}
+			if score < bestScore {
+				best, bestScore = i, score
+			}
+		}
+		if best < 0 {
+			break // No position left to cut, the remaining parts stay empty
+		}
+		parts[k] = strings.TrimSpace(string(runes[previous:best]))
+		previous = best
+	}
+	// The last part takes the rest of the text
+	parts[k] = strings.TrimSpace(string(runes[previous:]))
+	return parts
+}
+
+// splitList splits a comma-separated list, ignoring empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
 	}
-	return input
+	return items
 }
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestSplitTextProportionally(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		weights []float64
+		want    []string
+	}{
+		{"no weights", "text", nil, []string{}},
+		{"one weight", " one two ", []float64{1}, []string{"one two"}},
+		{"empty text", "", []float64{1, 1}, []string{"", ""}},
+		{"zero weights", "one two", []float64{0, 0}, []string{"one two", ""}},
+		{"words", "one two three four", []float64{1, 1}, []string{"one two", "three four"}},
+		{"uneven weights", "one two three four", []float64{3, 1}, []string{"one two three", "four"}},
+		{"punctuation preferred", "Well, I think so", []float64{1, 1}, []string{"Well,", "I think so"}},
+		{"characters", "一二三四", []float64{1, 1}, []string{"一二", "三四"}},
+		{"no part starting with punctuation", "一二。三四", []float64{1, 1}, []string{"一二。", "三四"}},
+		{"more parts than words", "one two", []float64{1, 1, 1}, []string{"one", "two", ""}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := splitTextProportionally(test.text, test.weights); !slices.Equal(got, test.want) {
+				t.Errorf("splitTextProportionally(%q, %v) = %q, want %q", test.text, test.weights, got, test.want)
+			}
+		})
+	}
+}
+
+func TestApplyFailurePolicy(t *testing.T) {
+	tests := []struct {
+		policy string
+		want   []string
+		err    bool
+	}{
+		{"keep", []string{"Bonjour", "Merci", ""}, false},
+		{"marker", []string{"Bonjour", "[!] Merci", "[!] "}, false},
+		{"empty", []string{"Bonjour", "", ""}, false},
+		{"drop", []string{"Bonjour", "Merci", ""}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.policy, func(t *testing.T) {
+			failed := errors.New("failed")
+			segments := []SrtSegment{{ID: "1", Text: "Bonjour"}, {ID: "2", Text: "Merci", Err: failed}, {ID: "3", Err: failed}}
+			err := applyFailurePolicy(segments, test.policy, "[!]")
+			if (err != nil) != test.err {
+				t.Fatalf("got error %v, want one: %t", err, test.err)
+			}
+			var texts []string
+			for _, segment := range segments {
+				texts = append(texts, segment.Text)
+			}
+			if !slices.Equal(texts, test.want) {
+				t.Errorf("got texts %q, want %q", texts, test.want)
+			}
+			if segments[1].Err == nil {
+				t.Error("the error of the failed segment was cleared")
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	watchStateFile = ".stgo-watch.json" // Files already processed, in the watched folder
+	watchWorkDir   = ".stgo-work"       // Outputs of the files being processed, in the watched folder
+	watchDoneDir   = "done"
+	watchFailedDir = "failed"
+)
+
+// WatchedFile is a file of the watched folder as seen, and the outcome of its processing once it is done.
+type WatchedFile struct {
+	Size      int64     `json:"size"`
+	ModTime   time.Time `json:"mod_time"`
+	Status    string    `json:"status,omitempty"` // "done" or "failed" once processed
+	Processed time.Time `json:"processed,omitempty"`
+}
+
+// watchState records the processed files of the watched folder by name, persisted so that a restart does not
+// translate a file again. A file dropped again with the same name but another size or modification time is
+// translated again.
+type watchState struct {
+	path  string
+	files map[string]WatchedFile
+}
+
+// loadWatchState loads the processed files of the watched folder, if any.
+func loadWatchState(path string) (*watchState, error) {
+	state := &watchState{path: path, files: make(map[string]WatchedFile)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &state.files); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return state, nil
+}
+
+// save writes the processed files to the state file.
+func (s *watchState) save() error {
+	data, err := json.MarshalIndent(s.files, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, data, 0644)
+}
+
+// watchFolder translates the subtitle files dropped into a folder, once their size and modification time have
+// not changed for the settle time. Each file is moved with its outputs into the done subfolder, or into the
+// failed subfolder if it could not be translated completely. A file already processed with the same size and
+// modification time is only moved, so a restart does not redo work. Runs until interrupted.
+func watchFolder(dir string, interval, settle time.Duration, config *Config) error {
+	state, err := loadWatchState(filepath.Join(dir, watchStateFile))
+	if err != nil {
+		return err
+	}
+	for _, subdir := range []string{watchWorkDir, watchDoneDir, watchFailedDir} {
+		if err := os.MkdirAll(filepath.Join(dir, subdir), 0755); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Watching %s every %s\n", dir, interval)
+	seen := make(map[string]WatchedFile)
+	stableSince := make(map[string]time.Time)
+	for ; ; time.Sleep(interval) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			fmt.Println("Error :", err) // The folder may be a network share coming back later
+			continue
+		}
+
+		var ready []inputFile
+		for _, entry := range entries {
+			name := entry.Name()
+			if entry.IsDir() || !isSubtitleFile(name) {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				continue // Moved or deleted since the folder was read
+			}
+			snapshot := WatchedFile{Size: info.Size(), ModTime: info.ModTime()}
+
+			if processed, ok := state.files[name]; ok && sameFile(processed, snapshot) {
+				// Processed before a restart or a failed move, only move it
+				finishWatchedFile(dir, name, processed.Status)
+				continue
+			}
+			if last, ok := seen[name]; !ok || !sameFile(last, snapshot) {
+				// New or still being written
+				seen[name] = snapshot
+				stableSince[name] = time.Now()
+				continue
+			}
+			if time.Since(stableSince[name]) >= settle {
+				// Each file has its own folder in the work folder, so that its outputs can be moved together
+				ready = append(ready, inputFile{filepath.Join(dir, name), filepath.Join(name, name)})
+			}
+		}
+		if len(ready) == 0 {
+			continue
+		}
+
+		for _, file := range ready {
+			// Outputs of an interrupted run
+			if err := os.RemoveAll(filepath.Join(dir, watchWorkDir, filepath.Base(file.path))); err != nil {
+				fmt.Println("Error :", err)
+			}
+		}
+		statuses := translateFiles(ready, config)
+		if err := config.memory.save(); err != nil {
+			fmt.Println("Error :", err)
+		}
+
+		for _, status := range statuses {
+			name := filepath.Base(status.file.path)
+			processed := seen[name]
+			processed.Status = watchDoneDir
+			if status.err != nil || status.failed > 0 {
+				processed.Status = watchFailedDir
+			}
+			processed.Processed = time.Now()
+			state.files[name] = processed
+			delete(seen, name)
+			delete(stableSince, name)
+		}
+		if err := state.save(); err != nil {
+			fmt.Println("Error :", err)
+		}
+		for _, status := range statuses {
+			name := filepath.Base(status.file.path)
+			finishWatchedFile(dir, name, state.files[name].Status)
+			fmt.Printf("%s: %s, moved to %s\n", name, status.describe(), state.files[name].Status)
+		}
+		if config.translator == "openai" {
+			fmt.Printf("Usage so far: %s\n", config.usage.describe(config))
+		}
+	}
+}
+
+// sameFile reports whether two snapshots of a file have the same size and modification time.
+func sameFile(a, b WatchedFile) bool {
+	return a.Size == b.Size && a.ModTime.Equal(b.ModTime)
+}
+
+// finishWatchedFile moves a processed file and its outputs from the work folder into the done or failed
+// subfolder. A file of the same name already there is replaced.
+func finishWatchedFile(dir string, name string, status string) {
+	target := filepath.Join(dir, status)
+	work := filepath.Join(dir, watchWorkDir, name)
+	outputs, _ := os.ReadDir(work)
+	for _, output := range outputs {
+		if err := os.Rename(filepath.Join(work, output.Name()), filepath.Join(target, output.Name())); err != nil {
+			fmt.Println("Error :", err)
+		}
+	}
+	if err := os.Remove(work); err != nil && !errors.Is(err, os.ErrNotExist) {
+		fmt.Println("Error :", err)
+	}
+	if err := os.Rename(filepath.Join(dir, name), filepath.Join(target, name)); err != nil {
+		fmt.Println("Error :", err)
+	}
+}
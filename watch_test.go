@@ -0,0 +1,116 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatchState(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, watchStateFile)
+
+	state, err := loadWatchState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.files) != 0 {
+		t.Fatalf("got %v without a state file, want nothing", state.files)
+	}
+
+	modTime := time.Date(2024, 5, 1, 12, 30, 0, 123456789, time.FixedZone("CEST", 2*60*60))
+	state.files["a.srt"] = WatchedFile{Size: 120, ModTime: modTime, Status: watchDoneDir, Processed: modTime.Add(time.Minute)}
+	state.files["b.vtt"] = WatchedFile{Size: 80, ModTime: modTime, Status: watchFailedDir}
+	if err := state.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := loadWatchState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.files) != 2 {
+		t.Fatalf("got %v, want 2 files", loaded.files)
+	}
+	for name, want := range state.files {
+		got := loaded.files[name]
+		if !sameFile(got, want) || got.Status != want.Status || !got.Processed.Equal(want.Processed) {
+			t.Errorf("%s: got %+v, want %+v", name, got, want)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadWatchState(path); err == nil {
+		t.Error("got no error for a corrupt state file")
+	}
+}
+
+func TestSameFile(t *testing.T) {
+	modTime := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		a, b WatchedFile
+		want bool
+	}{
+		{"same", WatchedFile{Size: 10, ModTime: modTime}, WatchedFile{Size: 10, ModTime: modTime, Status: watchDoneDir}, true},
+		{"same time in another zone", WatchedFile{Size: 10, ModTime: modTime}, WatchedFile{Size: 10, ModTime: modTime.In(time.FixedZone("", 3600))}, true},
+		{"other size", WatchedFile{Size: 10, ModTime: modTime}, WatchedFile{Size: 11, ModTime: modTime}, false},
+		{"other time", WatchedFile{Size: 10, ModTime: modTime}, WatchedFile{Size: 10, ModTime: modTime.Add(time.Second)}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := sameFile(test.a, test.b); got != test.want {
+				t.Errorf("sameFile = %t, want %t", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFinishWatchedFile(t *testing.T) {
+	dir := t.TempDir()
+	work := filepath.Join(dir, watchWorkDir, "a.srt")
+	for _, path := range []string{
+		filepath.Join(dir, "a.srt"),
+		filepath.Join(work, "a.openai.translated.srt"),
+		filepath.Join(work, "a.report.json"),
+		filepath.Join(dir, watchDoneDir, "a.openai.translated.srt"), // Left by a previous run, replaced
+	} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(filepath.Base(filepath.Dir(path))), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	finishWatchedFile(dir, "a.srt", watchDoneDir)
+	for _, name := range []string{"a.srt", "a.openai.translated.srt", "a.report.json"} {
+		if _, err := os.Stat(filepath.Join(dir, watchDoneDir, name)); err != nil {
+			t.Errorf("%s not moved: %v", name, err)
+		}
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, watchDoneDir, "a.openai.translated.srt")); string(data) != "a.srt" {
+		t.Errorf("got the output %q of a previous run", data)
+	}
+	for _, path := range []string{filepath.Join(dir, "a.srt"), work} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s still exists", path)
+		}
+	}
+
+	// A file without outputs, such as one processed before a restart, is moved alone
+	if err := os.WriteFile(filepath.Join(dir, "b.srt"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, watchFailedDir), 0755); err != nil {
+		t.Fatal(err)
+	}
+	finishWatchedFile(dir, "b.srt", watchFailedDir)
+	if _, err := os.Stat(filepath.Join(dir, watchFailedDir, "b.srt")); err != nil {
+		t.Errorf("b.srt not moved: %v", err)
+	}
+}